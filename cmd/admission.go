@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/admission"
+	"github.com/postfinance/kubewire/pkg/journal"
+	"github.com/spf13/cobra"
+)
+
+// admissionCmd represents the admission command
+var admissionCmd = &cobra.Command{
+	Use:   "admission",
+	Short: "Serve a validating admission webhook recording who changes objects",
+	Long: `Serves a validating admission webhook, which records the user, groups,
+operation and identity of every object created, updated or deleted into the
+journal file. Objects in other than the given namespaces are not recorded.
+The journal is rotated to the file with the suffix .1 at --journal-max-size,
+'diff --journal' reads both files.
+
+The webhook only audits, it allows every request. Register it with the
+failurePolicy Ignore, so that the cluster is not affected if it is unavailable.
+'diff --journal' annotates the differences with their last recorded change.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		certFile := cmd.Flag("tls-cert-file").Value.String()
+		keyFile := cmd.Flag("tls-private-key-file").Value.String()
+		if certFile == "" || keyFile == "" {
+			fatal(ExitUsage, "--tls-cert-file and --tls-private-key-file are required, the API server only calls webhooks over https")
+		}
+
+		maxSize, err := cmd.Flags().GetInt64("journal-max-size")
+		if err != nil {
+			panic(err) // This should never occure
+		}
+		if maxSize < 0 {
+			fatal(ExitUsage, "--journal-max-size must not be negative")
+		}
+
+		j, err := journal.Open(cmd.Flag("journal").Value.String(), maxSize*1024*1024)
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+		defer j.Close()
+
+		namespaces := strings.Split(cmd.Flag("namespaces").Value.String(), ",")
+
+		mux := http.NewServeMux()
+		mux.Handle("/validate", admission.New(j, namespaces))
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok\n"))
+		})
+
+		srv := &http.Server{
+			Addr:    cmd.Flag("listen").Value.String(),
+			Handler: mux,
+		}
+
+		// The journal is closed once the shutdown has drained the handlers
+		done := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			defer close(done)
+			<-signals
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			srv.Shutdown(ctx)
+		}()
+
+		err = srv.ListenAndServeTLS(certFile, keyFile)
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalln(err)
+		}
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(admissionCmd)
+	admissionCmd.Flags().String("journal", "journal.jsonl", "File to append the recorded changes to")
+	admissionCmd.Flags().Int64("journal-max-size", 100, "Size in MiB to rotate the journal at, 0 to never rotate it")
+	admissionCmd.Flags().StringP("namespaces", "n", "default,kube-public,kube-system", "Namespaces to record the changes of, commaseparated")
+	admissionCmd.Flags().String("listen", ":8443", "Address to serve the webhook on /validate")
+	admissionCmd.Flags().String("tls-cert-file", "", "File with the certificate to serve https")
+	admissionCmd.Flags().String("tls-private-key-file", "", "File with the private key matching --tls-cert-file")
+}
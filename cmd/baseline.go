@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/crd"
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/store"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// baselineCmd represents the baseline command
+var baselineCmd = &cobra.Command{
+	Use:   "baseline",
+	Short: "Maintain a baseline",
+}
+
+// baselineAcceptCmd represents the baseline accept command
+var baselineAcceptCmd = &cobra.Command{
+	Use:   "accept",
+	Short: "Accept selected differences into the baseline",
+	Long: `Applies the differences between the baseline and a snapshot or the
+live cluster, which match all of the selectors, to the baseline. Who accepted
+which differences and why is recorded in the Audit section of the baseline.
+
+The selectors are patterns like the ones of ignore rules, at least one is
+required so that nothing is accepted unreviewed. Differences of unknown state
+are never accepted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		reason := cmd.Flag("reason").Value.String()
+		if reason == "" {
+			fatal(ExitUsage, "--reason is required")
+		}
+
+		changes, err := parseChanges(cmd.Flag("changes").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		rule := report.IgnoreRule{
+			Group:     cmd.Flag("group").Value.String(),
+			Resource:  cmd.Flag("resource").Value.String(),
+			Namespace: cmd.Flag("namespace").Value.String(),
+			Name:      cmd.Flag("name").Value.String(),
+			Changes:   changes,
+		}
+		if rule.Group == "" && rule.Resource == "" && rule.Namespace == "" && rule.Name == "" && len(rule.Changes) == 0 {
+			fatal(ExitUsage, "at least one selector is required")
+		}
+
+		selector := &report.Ignore{Rules: []report.IgnoreRule{rule}}
+		if err := selector.Compile(); err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		// Read reports
+		baselineFile := cmd.Flag("baseline").Value.String()
+		baseline, err := loadReport(baselineFile)
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		var live *report.Report
+		if snapshotFile := cmd.Flag("snapshot").Value.String(); snapshotFile == "" {
+			live, err = GetReport(baseline.Configuration)
+			if err != nil {
+				fatal(ExitRetrieval, err)
+			}
+		} else {
+			live, err = loadReport(snapshotFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		// Accept
+		updated, accepted := report.Accept(*baseline, *live, selector)
+		if len(accepted) == 0 {
+			log.Println("no differences match the selectors")
+			return
+		}
+
+		printDiffWide(accepted)
+		if dryRun {
+			return
+		}
+
+		updated.Audit = append(updated.Audit, report.Acceptance{
+			Time:     time.Now(),
+			User:     cmd.Flag("user").Value.String(),
+			Reason:   reason,
+			Selector: rule,
+			Accepted: accepted,
+		})
+
+		target := cmd.Flag("target").Value.String()
+		if target == "" {
+			target = baselineFile
+		}
+
+		err = writeBaseline(updated, target)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+// baselinePushCmd represents the baseline push command
+var baselinePushCmd = &cobra.Command{
+	Use:   "push FILE NAME",
+	Short: "Store a baseline as KubewireBaseline in the cluster",
+	Long: `Stores the baseline from FILE, which may be a store reference like
+@baseline as well, compressed in the KubewireBaseline NAME of the cluster. It
+is created if it does not exist yet. Other commands load it with the baseline
+reference kubewirebaseline/NAME. The CustomResourceDefinition of
+deployment/crd.yaml must be installed.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		baseline, err := loadReport(args[0])
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		err = writeBaseline(*baseline, crd.RefPrefix+args[1])
+		if err != nil {
+			fatal(ExitRetrieval, err)
+		}
+	},
+}
+
+// baselinePullCmd represents the baseline pull command
+var baselinePullCmd = &cobra.Command{
+	Use:   "pull NAME [FILE]",
+	Short: "Load a baseline from a KubewireBaseline of the cluster",
+	Long: `Loads the baseline from the KubewireBaseline NAME of the cluster and
+writes it in yaml format to FILE or, if omitted, to stdout.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		baseline, err := loadReport(crd.RefPrefix + args[0])
+		if err != nil {
+			fatal(ExitRetrieval, err)
+		}
+
+		if len(args) == 1 {
+			printYaml(baseline)
+			return
+		}
+
+		err = writeBaseline(*baseline, args[1])
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(baselineCmd)
+	baselineCmd.AddCommand(baselineAcceptCmd)
+	baselineCmd.AddCommand(baselinePushCmd)
+	baselineCmd.AddCommand(baselinePullCmd)
+
+	baselineAcceptCmd.Flags().StringP("baseline", "b", "baseline.yaml", "Baseline report in yaml format, store reference e.g. @baseline or kubewirebaseline/NAME")
+	baselineAcceptCmd.Flags().StringP("snapshot", "s", "", "Snapshot in yaml format or store reference e.g. @latest to accept from, empty to run against live cluster")
+	baselineAcceptCmd.Flags().String("target", "", "File to write the updated baseline to, empty for the baseline. A store reference saves it as new snapshot marked as baseline, kubewirebaseline/NAME in the cluster")
+	baselineAcceptCmd.Flags().StringP("group", "g", "", "Select differences of resources and objects of API groups matching this pattern")
+	baselineAcceptCmd.Flags().StringP("resource", "r", "", "Select differences of resources and objects of resources matching this pattern")
+	baselineAcceptCmd.Flags().StringP("namespace", "n", "", "Select differences of objects in namespaces matching this pattern")
+	baselineAcceptCmd.Flags().String("name", "", "Select differences of objects with names matching this pattern")
+	baselineAcceptCmd.Flags().String("changes", "", "Select differences of these change types, commaseparated: added|removed|modified|recreated|new-field-manager")
+	baselineAcceptCmd.Flags().String("reason", "", "Why the differences are accepted, recorded in the audit section")
+	baselineAcceptCmd.Flags().String("user", currentUser(), "Who accepts the differences, recorded in the audit section")
+	baselineAcceptCmd.Flags().Bool("dry-run", false, "Only print the differences which would be accepted")
+}
+
+// parseChanges parses and validates the commaseparated change types of
+// resources and resource objects
+func parseChanges(s string) ([]string, error) {
+	ret := []string{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		switch c {
+		case "":
+			continue
+		case report.ChangeAdded, report.ChangeRemoved, report.ChangeModified, report.ChangeRecreated, report.ChangeNewManager:
+			ret = append(ret, c)
+		default:
+			return nil, fmt.Errorf("unknown change type %s", c)
+		}
+	}
+
+	return ret, nil
+}
+
+// writeBaseline writes the baseline rep to file, for store references saves it
+// in the store and marks it as baseline or, for references like
+// kubewirebaseline/production, pushes it to the KubewireBaseline in the cluster
+func writeBaseline(rep report.Report, file string) error {
+	if crd.IsRef(file) {
+		c, err := baselineClient("")
+		if err != nil {
+			return err
+		}
+
+		return c.Push(crd.RefName(file), rep)
+	}
+
+	if !store.IsRef(file) {
+		raw, err := yaml.Marshal(rep)
+		if err != nil {
+			return err
+		}
+
+		return store.WriteFile(file, raw, 0644)
+	}
+
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	id, err := s.Save(rep)
+	if err != nil {
+		return err
+	}
+
+	return s.SetBaseline(id)
+}
+
+// currentUser returns the name of the user running kubewire
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check a snapshot or a live cluster against a policy",
+	Long: `Checks the resource objects of a snapshot or of the live cluster against
+the allow and deny rules of a policy, which declares the expected state instead
+of a full baseline. Every object violating a rule is reported as added, every
+resource which could not be listed but is selected by a rule as unknown.
+
+The output formats and exit codes are the same as the ones of 'diff'. Rules
+selecting objects by their fields need the object content, which is recorded
+when scanning the live cluster but must be in the snapshot otherwise.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output := cmd.Flag("output").Value.String()
+		if output != "wide" && output != "json" && output != "yaml" {
+			fatal(ExitUsage, "Unknown output format", output)
+		}
+
+		failOn, err := parseFailOn(cmd.Flag("fail-on").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		policy, err := readPolicy(cmd.Flag("policy").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		var rep *report.Report
+		if snapshotFile := cmd.Flag("snapshot").Value.String(); snapshotFile == "" {
+			namespaces := strings.Split(cmd.Flag("namespaces").Value.String(), ",")
+			if len(namespaces) == 1 && namespaces[0] == "" {
+				namespaces = []string{}
+			}
+
+			preferred, err := cmd.Flags().GetBool("preferred-versions")
+			if err != nil {
+				panic(err) // This should never occure
+			}
+
+			rep, err = GetReport(report.Configuration{
+				Namespaces:        namespaces,
+				PreferredVersions: preferred,
+				Content:           policy.NeedsContent(),
+			})
+			if err != nil {
+				fatal(ExitRetrieval, err)
+			}
+		} else {
+			rep, err = loadReport(snapshotFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+
+			if policy.NeedsContent() && !rep.Configuration.Content {
+				fatal(ExitUsage, "the policy selects objects by their fields, the snapshot must be taken with --content")
+			}
+		}
+
+		result := policy.Check(*rep)
+		printDiffResult(result, output)
+
+		if result.Drift(failOn) {
+			os.Exit(ExitDrift)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().StringP("policy", "p", "policy.yaml", "File in yaml format with the rules of the expected state")
+	checkCmd.Flags().StringP("snapshot", "s", "", "Snapshot in yaml format or store reference e.g. @latest to check, empty to check the live cluster")
+	checkCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+	checkCmd.Flags().String("fail-on", strings.Join(report.DefaultFailOn, ","), "Change types which are considered as drift, commaseparated: added|unknown")
+	checkCmd.Flags().StringP("namespaces", "n", "default,kube-public,kube-system", "Namespaces to scrape when scanning, commaseparated")
+	checkCmd.Flags().Bool("preferred-versions", true, "Scan only the preferred version of every API group")
+}
+
+// readPolicy reads and compiles the policy from file
+func readPolicy(file string) (*report.Policy, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &report.Policy{}
+	err = yaml.UnmarshalStrict(raw, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	err = policy.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare two clusters",
+	Long: `Compares the resources and resource objects of two clusters, which
+are either scanned live from two kubeconfig contexts in parallel or read from
+snapshots. The per cluster metadata like the scan times, the server and the
+configuration is not compared.
+
+Names of objects which differ between clusters, e.g. the random suffixes of
+service account tokens, can be normalized with the name rules of --rules.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output := cmd.Flag("output").Value.String()
+		if output != "wide" && output != "json" && output != "yaml" {
+			fatal(ExitUsage, "Unknown output format", output)
+		}
+
+		failOn, err := parseFailOn(cmd.Flag("fail-on").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		var ignore *report.Ignore
+		if ignoreFile := cmd.Flag("ignore").Value.String(); ignoreFile != "" {
+			ignore, err = readIgnore(ignoreFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		var names *report.Normalization
+		if rulesFile := cmd.Flag("rules").Value.String(); rulesFile != "" {
+			names, err = readNormalization(rulesFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		sides := []string{"a", "b"}
+		for _, side := range sides {
+			if (cmd.Flag("context-"+side).Value.String() == "") == (cmd.Flag("snapshot-"+side).Value.String() == "") {
+				fatal(ExitUsage, fmt.Sprintf("exactly one of --context-%s and --snapshot-%s is required", side, side))
+			}
+		}
+
+		conf, err := compareConfiguration(cmd)
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		// Read or scan both sides in parallel
+		reports := make([]*report.Report, len(sides))
+		errs := make([]error, len(sides))
+		codes := make([]int, len(sides))
+
+		wg := sync.WaitGroup{}
+		for i, side := range sides {
+			wg.Add(1)
+			go func(i int, side string) {
+				defer wg.Done()
+
+				if file := cmd.Flag("snapshot-" + side).Value.String(); file != "" {
+					reports[i], errs[i] = loadReport(file)
+					codes[i] = ExitUsage
+				} else {
+					reports[i], errs[i] = GetContextReport(cmd.Flag("context-"+side).Value.String(), conf)
+					codes[i] = ExitRetrieval
+				}
+			}(i, side)
+		}
+		wg.Wait()
+
+		for i := range sides {
+			if errs[i] != nil {
+				fatal(codes[i], sides[i]+":", errs[i])
+			}
+		}
+
+		// Compare
+		result := report.CompareReports(*reports[0], *reports[1], names, ignore)
+
+		printDiffResult(result, output)
+
+		if result.Drift(failOn) {
+			os.Exit(ExitDrift)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().String("context-a", "", "Kubeconfig context of the cluster to scan as side A")
+	compareCmd.Flags().String("context-b", "", "Kubeconfig context of the cluster to scan as side B")
+	compareCmd.Flags().String("snapshot-a", "", "Snapshot in yaml format or store reference to read as side A instead of scanning")
+	compareCmd.Flags().String("snapshot-b", "", "Snapshot in yaml format or store reference to read as side B instead of scanning")
+	compareCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+	compareCmd.Flags().StringP("rules", "r", "", "File in yaml format with rules to normalize object names")
+	compareCmd.Flags().StringP("ignore", "i", "", "File in yaml format with rules for differences to ignore")
+	compareCmd.Flags().String("fail-on", strings.Join(report.DefaultFailOn, ","), "Change types which are considered as drift, commaseparated: added|removed|modified|resource-schema|unknown|recreated|new-field-manager")
+	compareCmd.Flags().StringP("namespaces", "n", "default,kube-public,kube-system", "Namespaces to scrape when scanning, commaseparated")
+	compareCmd.Flags().Bool("content-hash", false, "Record a fingerprint of every object when scanning to detect modifications")
+	compareCmd.Flags().Bool("preferred-versions", true, "Scan only the preferred version of every API group")
+}
+
+// compareConfiguration returns the scanning configuration of the flags of cmd
+func compareConfiguration(cmd *cobra.Command) (report.Configuration, error) {
+	namespaces := strings.Split(cmd.Flag("namespaces").Value.String(), ",")
+	if len(namespaces) == 1 && namespaces[0] == "" {
+		namespaces = []string{}
+	}
+
+	contentHash, err := cmd.Flags().GetBool("content-hash")
+	if err != nil {
+		return report.Configuration{}, err
+	}
+
+	preferred, err := cmd.Flags().GetBool("preferred-versions")
+	if err != nil {
+		return report.Configuration{}, err
+	}
+
+	return report.Configuration{
+		Namespaces:        namespaces,
+		PreferredVersions: preferred,
+		ContentHash:       contentHash,
+	}, nil
+}
+
+// readNormalization reads and compiles the name rules from file
+func readNormalization(file string) (*report.Normalization, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	names := &report.Normalization{}
+	err = yaml.UnmarshalStrict(raw, names)
+	if err != nil {
+		return nil, err
+	}
+
+	err = names.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
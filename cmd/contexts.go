@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/postfinance/kubewire/pkg/access"
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+// contextPlaceholder is replaced by the context name in file flags, when
+// multiple clusters are scanned
+const contextPlaceholder = "{context}"
+
+// unsafeFileChars matches the characters of context names which are replaced
+// in file names e.g. of EKS contexts like arn:aws:eks:eu-west-1:1234:cluster/a
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// contextResult holds the outcome of a command for the cluster of a context
+type contextResult struct {
+	Context  string
+	Snapshot string             `yaml:",omitempty" json:",omitempty"` // ID or file of the snapshot taken
+	Result   *report.DiffResult `yaml:",omitempty" json:",omitempty"`
+	Error    string             `yaml:",omitempty" json:",omitempty"`
+}
+
+// addContextsFlags adds the flags to select multiple clusters to cmd
+func addContextsFlags(cmd *cobra.Command) {
+	cmd.Flags().String("contexts", "", "Scan the clusters of these kubeconfig contexts in parallel, commaseparated")
+	cmd.Flags().Bool("all-contexts", false, "Scan the clusters of all kubeconfig contexts in parallel")
+}
+
+// selectedContexts returns the contexts selected by the contexts flags of cmd
+// or nil if a single cluster is scanned
+func selectedContexts(cmd *cobra.Command) ([]string, error) {
+	all, err := cmd.Flags().GetBool("all-contexts")
+	if err != nil {
+		return nil, err
+	}
+
+	list := cmd.Flag("contexts").Value.String()
+
+	switch {
+	case all && list != "":
+		return nil, errors.New("--contexts and --all-contexts are mutually exclusive")
+	case (all || list != "") && rootContext() != "":
+		return nil, errors.New("--context can not be combined with --contexts or --all-contexts")
+	case all:
+		kcfg, err := rootCmd.PersistentFlags().GetString("kubeconfig")
+		if err != nil {
+			panic(err) // This should never occure
+		}
+
+		contexts, err := access.Contexts(kcfg)
+		if err != nil {
+			return nil, err
+		}
+		if len(contexts) == 0 {
+			return nil, errors.New("no kubeconfig contexts found")
+		}
+
+		return contexts, nil
+	case list != "":
+		contexts := []string{}
+		for _, c := range strings.Split(list, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				contexts = append(contexts, c)
+			}
+		}
+
+		return contexts, nil
+	}
+
+	return nil, nil
+}
+
+// forContexts runs fn for every context in parallel and returns the results in
+// the order of contexts
+func forContexts(contexts []string, fn func(context string, result *contextResult) error) []contextResult {
+	ret := make([]contextResult, len(contexts))
+
+	wg := sync.WaitGroup{}
+	for i := range contexts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ret[i].Context = contexts[i]
+			if err := fn(contexts[i], &ret[i]); err != nil {
+				ret[i].Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return ret
+}
+
+// scannedContext returns the kubeconfig context scanned for context, the
+// current one if it is empty, or empty in cluster or if it is unknown
+func scannedContext(context string) string {
+	if context != "" {
+		return context
+	}
+
+	kcfg, err := rootCmd.PersistentFlags().GetString("kubeconfig")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	if kcfg == "" && access.IsInCluster() {
+		return ""
+	}
+
+	current, err := access.CurrentContext(kcfg)
+	if err != nil {
+		return ""
+	}
+
+	return current
+}
+
+// liveContext returns the context to scan for a comparison with a baseline of
+// the recorded context. Unless the cluster is selected explicitly, the one of
+// the baseline is scanned instead of the current context, which must then be
+// part of the kubeconfig.
+func liveContext(context, recorded string) (string, error) {
+	if context == "" {
+		context = rootContext()
+	}
+	if context != "" || recorded == "" || access.SelectsCluster(configOverrides()) || scannedContext("") == "" {
+		return context, nil
+	}
+
+	kcfg, err := rootCmd.PersistentFlags().GetString("kubeconfig")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	contexts, err := access.Contexts(kcfg)
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range contexts {
+		if c == recorded {
+			return recorded, nil
+		}
+	}
+
+	return "", fmt.Errorf("the baseline was taken of the context %s, which is not in the kubeconfig, select the cluster with --context", recorded)
+}
+
+// contextFile returns a file name for the context
+func contextFile(context string) string {
+	return unsafeFileChars.ReplaceAllString(context, "_")
+}
+
+// expandContext replaces the context placeholder in file by the context
+func expandContext(file string, context string) string {
+	return strings.Replace(file, contextPlaceholder, contextFile(context), -1)
+}
+
+// failed returns true if the command failed for one of the clusters
+func failed(data []contextResult) bool {
+	for _, d := range data {
+		if d.Error != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printSnapshotContextsWide prints a summary table of the snapshots of all
+// clusters
+func printSnapshotContextsWide(data []contextResult) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "Context\tSnapshot\tError")
+
+	for _, d := range data {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", d.Context, d.Snapshot, d.Error)
+	}
+
+	w.Flush()
+}
+
+// printDiffContextsWide prints a summary table of the changes of all clusters
+func printDiffContextsWide(data []contextResult) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "Context\tAdded\tRemoved\tModified\tSchema\tUnknown\tError")
+
+	for _, d := range data {
+		changes := map[string]int{}
+		if d.Result != nil {
+			changes = d.Result.Changes
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", d.Context, changes[report.ChangeAdded], changes[report.ChangeRemoved],
+			changes[report.ChangeModified], changes[report.ChangeSchema], changes[report.ChangeUnknown], d.Error)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: c
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: u
+  user:
+    token: x
+contexts:
+- name: prod
+  context: {cluster: c, user: u}
+- name: dev
+  context: {cluster: c, user: u}
+`
+
+// setRootFlag sets a persistent flag of the root command, the returned
+// function resets it
+func setRootFlag(t *testing.T, name, value string) func() {
+	if err := rootCmd.PersistentFlags().Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() { rootCmd.PersistentFlags().Set(name, "") }
+}
+
+// useKubeconfig writes the test kubeconfig and sets the kubeconfig flag, the
+// returned function removes it
+func useKubeconfig(t *testing.T) func() {
+	f, err := ioutil.TempFile("", "kubewire-kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(testKubeconfig)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		t.Fatal(err)
+	}
+
+	reset := setRootFlag(t, "kubeconfig", f.Name())
+
+	return func() {
+		reset()
+		os.Remove(f.Name())
+	}
+}
+
+func TestSelectedContexts(t *testing.T) {
+	defer useKubeconfig(t)()
+
+	for _, tc := range []struct {
+		context  string
+		contexts string
+		all      bool
+		exp      []string
+		err      string
+	}{
+		{},
+		{context: "prod"},
+		{contexts: "prod", exp: []string{"prod"}},
+		{contexts: " prod, ,dev ", exp: []string{"prod", "dev"}},
+		{all: true, exp: []string{"dev", "prod"}},
+		{contexts: "prod", all: true, err: "mutually exclusive"},
+		{context: "prod", contexts: "dev", err: "can not be combined"},
+		{context: "prod", all: true, err: "can not be combined"},
+	} {
+		t.Run(tc.context+"/"+tc.contexts, func(t *testing.T) {
+			defer setRootFlag(t, "context", tc.context)()
+
+			cmd := &cobra.Command{}
+			addContextsFlags(cmd)
+			if err := cmd.Flags().Set("contexts", tc.contexts); err != nil {
+				t.Fatal(err)
+			}
+			if tc.all {
+				if err := cmd.Flags().Set("all-contexts", "true"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			contexts, err := selectedContexts(cmd)
+			switch {
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("Got the error %v, expected %s", err, tc.err)
+			case tc.err == "" && err != nil:
+				t.Error(err)
+			case !reflect.DeepEqual(contexts, tc.exp):
+				t.Errorf("Got %v, expected %v", contexts, tc.exp)
+			}
+		})
+	}
+}
+
+func TestScannedContext(t *testing.T) {
+	defer useKubeconfig(t)()
+
+	if c := scannedContext("dev"); c != "dev" {
+		t.Errorf("Got %s, expected dev", c)
+	}
+	if c := scannedContext(""); c != "prod" {
+		t.Errorf("Got %s, expected the current context prod", c)
+	}
+}
+
+func TestExpandContext(t *testing.T) {
+	for _, tc := range []struct {
+		file    string
+		context string
+		exp     string
+	}{
+		{"baselines/{context}.yaml", "prod", "baselines/prod.yaml"},
+		{"baselines/{context}.yaml", "arn:aws:eks:eu-west-1:1234:cluster/a", "baselines/arn_aws_eks_eu-west-1_1234_cluster_a.yaml"},
+		{"{context}/{context}.yaml", "kind-kind", "kind-kind/kind-kind.yaml"},
+		{"baseline.yaml", "prod", "baseline.yaml"},
+		{"@latest", "gke_p_europe-west6_c", "@latest"},
+		{"{context}.yaml", "", ".yaml"},
+	} {
+		if s := expandContext(tc.file, tc.context); s != tc.exp {
+			t.Errorf("%s for %s: got %s, expected %s", tc.file, tc.context, s, tc.exp)
+		}
+	}
+}
+
+func TestForContexts(t *testing.T) {
+	var calls int32
+	data := forContexts([]string{"a", "b", "c", "d"}, func(context string, result *contextResult) error {
+		atomic.AddInt32(&calls, 1)
+		if context == "b" || context == "d" {
+			return errors.New("unreachable " + context)
+		}
+
+		result.Snapshot = context + ".yaml"
+		return nil
+	})
+
+	if calls != 4 {
+		t.Errorf("Got %d calls, expected 4", calls)
+	}
+
+	exp := []contextResult{
+		{Context: "a", Snapshot: "a.yaml"},
+		{Context: "b", Error: "unreachable b"},
+		{Context: "c", Snapshot: "c.yaml"},
+		{Context: "d", Error: "unreachable d"},
+	}
+	if !reflect.DeepEqual(data, exp) {
+		t.Errorf("Got %+v, expected %+v", data, exp)
+	}
+
+	if !failed(data) {
+		t.Error("Expected the results to fail")
+	}
+	if failed(data[:1]) || failed(nil) {
+		t.Error("Expected the results without errors not to fail")
+	}
+}
+
+func TestLiveContext(t *testing.T) {
+	defer useKubeconfig(t)()
+
+	for _, tc := range []struct {
+		root     string
+		context  string
+		recorded string
+		exp      string
+		err      bool
+	}{
+		{recorded: "dev", exp: "dev"},
+		{recorded: "", exp: ""},
+		{recorded: "staging", err: true},
+		{context: "prod", recorded: "dev", exp: "prod"},
+		{root: "prod", recorded: "dev", exp: "prod"},
+	} {
+		reset := setRootFlag(t, "context", tc.root)
+		c, err := liveContext(tc.context, tc.recorded)
+		reset()
+
+		switch {
+		case tc.err && err == nil:
+			t.Errorf("%+v: expected an error", tc)
+		case !tc.err && err != nil:
+			t.Errorf("%+v: %s", tc, err)
+		case c != tc.exp:
+			t.Errorf("%+v: got %s, expected %s", tc, c, tc.exp)
+		}
+	}
+}
@@ -5,11 +5,19 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"text/tabwriter"
 
+	"github.com/postfinance/kubewire/pkg/audit"
+	"github.com/postfinance/kubewire/pkg/crd"
+	"github.com/postfinance/kubewire/pkg/events"
+	"github.com/postfinance/kubewire/pkg/journal"
+	"github.com/postfinance/kubewire/pkg/notify"
 	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/store"
 	"github.com/spf13/cobra"
 	yaml "gopkg.in/yaml.v2"
+	"k8s.io/client-go/kubernetes"
 )
 
 // diffCmd represents the diff command
@@ -17,77 +25,466 @@ var diffCmd = &cobra.Command{
 	Use:   "diff",
 	Short: "Compare snapshots with another or a live cluster",
 	Long: `Compares the state from the baseline with
-the current state of the cluster or another snapshot. The namespaces defined in the
-baseline report are used for snapshotting the live cluster.`,
+the current state of the cluster or another snapshot. The configuration of the
+baseline report, e.g. the namespaces, is used for snapshotting the live cluster.
+Without --context the live cluster is the one of the context recorded in the
+baseline, which must be part of the kubeconfig.
+
+With --contexts or --all-contexts the clusters of multiple kubeconfig contexts
+are compared in parallel, followed by a summary of their changes. The baseline
+and snapshot files must contain the placeholder {context}, store references
+are resolved in the subdirectory of the store named after the context.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Read report
-		baselineFile := cmd.Flag("baseline").Value.String()
-		raw, err := ioutil.ReadFile(baselineFile)
-		if err != nil {
-			log.Fatalln(err)
+		output := cmd.Flag("output").Value.String()
+		if output != "wide" && output != "json" && output != "yaml" {
+			fatal(ExitUsage, "Unknown output format", output)
 		}
 
-		baseline := report.Report{}
-		err = yaml.Unmarshal(raw, &baseline)
+		failOn, err := parseFailOn(cmd.Flag("fail-on").Value.String())
 		if err != nil {
-			log.Fatalln(err)
+			fatal(ExitUsage, err)
 		}
 
-		snapshotFile := cmd.Flag("snapshot").Value.String()
-		live := &report.Report{}
-
-		if snapshotFile == "" {
-			// Create report
-			var err error
-			live, err = GetReport(baseline.Configuration.Namespaces)
-			if err != nil {
-				log.Fatalln(err)
-			}
-		} else {
-			// Read snapshot
-			raw, err := ioutil.ReadFile(snapshotFile)
+		// Ignore rules
+		var ignore *report.Ignore
+		if ignoreFile := cmd.Flag("ignore").Value.String(); ignoreFile != "" {
+			ignore, err = readIgnore(ignoreFile)
 			if err != nil {
-				log.Fatalln(err)
+				fatal(ExitUsage, err)
 			}
+		}
 
-			err = yaml.Unmarshal(raw, live)
+		var notifier *notify.Notifier
+		if notifyFile := cmd.Flag("notify").Value.String(); notifyFile != "" {
+			notifier, err = readNotifier(notifyFile)
 			if err != nil {
-				log.Fatalln(err)
+				fatal(ExitUsage, err)
 			}
 		}
 
+		recordEvents, err := cmd.Flags().GetBool("events")
+		if err != nil {
+			panic(err) // This should never occure
+		}
+		if recordEvents && cmd.Flag("snapshot").Value.String() != "" {
+			fatal(ExitUsage, "events are only recorded when diffing against the live cluster")
+		}
+
+		contexts, err := selectedContexts(cmd)
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		if contexts != nil {
+			diffContexts(cmd, contexts, ignore, failOn, notifier, recordEvents)
+			return
+		}
+
 		// Diff
-		data := report.DiffReports(baseline, *live)
+		live, result, code, err := diffContext(cmd, "", ignore)
+		if err != nil {
+			fatal(code, err)
+		}
 
 		// Printing
-		switch cmd.Flag("output").Value.String() {
-		case "wide":
-			printDiffWide(data)
-		case "json":
-			printJson(data)
-		case "yaml":
-			printYaml(data)
-		default:
-			log.Fatalf("Unknown output format %s", cmd.Flag("output").Value.String())
+		printDiffResult(*result, output)
+
+		if notifier != nil {
+			notifyDrift(notifier, live, result, failOn)
+		}
+
+		if recordEvents {
+			recordDrift("", live, result, failOn)
+		}
+
+		if baselineFile := cmd.Flag("baseline").Value.String(); crd.IsRef(baselineFile) && cmd.Flag("snapshot").Value.String() == "" {
+			updateBaselineStatus("", baselineFile, live, result, failOn)
+		}
+
+		if result.Drift(failOn) {
+			os.Exit(ExitDrift)
 		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(diffCmd)
-	diffCmd.Flags().StringP("baseline", "b", "baseline.yaml", "Baseline report in yaml format")
-	diffCmd.Flags().StringP("snapshot", "s", "", "Snapshot in yaml format to read in, empty to run against live cluster")
+	diffCmd.Flags().StringP("baseline", "b", "baseline.yaml", "Baseline report in yaml format, store reference e.g. @baseline or kubewirebaseline/NAME")
+	diffCmd.Flags().StringP("snapshot", "s", "", "Snapshot in yaml format or store reference e.g. @latest to read in, empty to run against live cluster")
 	diffCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+	diffCmd.Flags().StringP("ignore", "i", "", "File in yaml format with rules for differences to ignore")
+	diffCmd.Flags().String("fail-on", strings.Join(report.DefaultFailOn, ","), "Change types which are considered as drift, commaseparated: added|removed|modified|resource-schema|metadata|unknown|recreated|new-field-manager")
+	diffCmd.Flags().String("notify", "", "File in yaml format with webhooks to notify about drift")
+	diffCmd.Flags().String("journal", "", "Journal of the admission webhook to annotate the differences with their last change")
+	diffCmd.Flags().StringArray("audit-log", nil, "Audit log of the API server in JSON lines format to find who changed the objects between the scans, can be repeated e.g. for rotated logs")
+	diffCmd.Flags().Bool("events", false, "Record Kubernetes events on the objects which drifted")
+	addContextsFlags(diffCmd)
+}
+
+// diffContext compares the baseline of the cluster of context, empty for a
+// single cluster, with its snapshot or the live cluster. If it fails, the exit
+// code matching the error is returned along with it
+func diffContext(cmd *cobra.Command, context string, ignore *report.Ignore) (*report.Report, *report.DiffResult, int, error) {
+	// Read report
+	baselineFile := cmd.Flag("baseline").Value.String()
+	baseline, err := loadContextReport(expandContext(baselineFile, context), context)
+	if err != nil && crd.IsRef(baselineFile) {
+		return nil, nil, ExitRetrieval, err
+	}
+	if err != nil {
+		return nil, nil, ExitUsage, err
+	}
+
+	var live *report.Report
+	if snapshotFile := cmd.Flag("snapshot").Value.String(); snapshotFile == "" {
+		// Create report with the scanning configuration of the baseline, the
+		// cluster is the one of the baseline unless selected by the flags
+		recorded := baseline.Configuration.Context
+		scan, err := liveContext(context, recorded)
+		if err != nil {
+			return nil, nil, ExitUsage, err
+		}
+
+		live, err = GetContextReport(scan, baseline.Configuration)
+		if err != nil {
+			return nil, nil, ExitRetrieval, err
+		}
+
+		if scanned := scannedContext(live.Configuration.Context); recorded != "" && scanned != "" && recorded != scanned {
+			log.Printf("warning: the baseline was taken of the context %s, the live cluster is the one of %s", recorded, scanned)
+		}
+	} else {
+		// Read snapshot
+		live, err = loadContextReport(expandContext(snapshotFile, context), context)
+		if err != nil {
+			return nil, nil, ExitUsage, err
+		}
+	}
+
+	result := report.DiffReports(*baseline, *live, ignore)
+
+	if journalFile := cmd.Flag("journal").Value.String(); journalFile != "" {
+		entries, err := journal.Read(expandContext(journalFile, context))
+		if err != nil {
+			return nil, nil, ExitUsage, err
+		}
+		journal.Annotate(result.Differences, entries)
+	}
+
+	auditLogs, err := cmd.Flags().GetStringArray("audit-log")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+	if len(auditLogs) != 0 {
+		c := audit.NewCorrelator(result.Differences, baseline.ScanStart, live.ScanEnd)
+		for _, f := range auditLogs {
+			if err := c.ReadFile(expandContext(f, context)); err != nil {
+				return nil, nil, ExitUsage, err
+			}
+		}
+		c.Attach()
+	}
+
+	return live, &result, 0, nil
+}
+
+// diffContexts compares the clusters of multiple contexts in parallel with
+// their baselines and prints a summary of their changes
+func diffContexts(cmd *cobra.Command, contexts []string, ignore *report.Ignore, failOn []string, notifier *notify.Notifier, recordEvents bool) {
+	files := []string{cmd.Flag("baseline").Value.String(), cmd.Flag("snapshot").Value.String(), cmd.Flag("journal").Value.String()}
+	auditLogs, err := cmd.Flags().GetStringArray("audit-log")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	for _, f := range append(files, auditLogs...) {
+		if f != "" && !store.IsRef(f) && !crd.IsRef(f) && !strings.Contains(f, contextPlaceholder) {
+			fatal(ExitUsage, "the snapshot files of multiple contexts must contain", contextPlaceholder, "e.g. baselines/{context}.yaml")
+		}
+	}
+
+	data := forContexts(contexts, func(context string, result *contextResult) error {
+		live, diff, _, err := diffContext(cmd, context, ignore)
+		if err != nil {
+			return err
+		}
+
+		result.Result = diff
+		if notifier != nil {
+			notifyDrift(notifier, live, diff, failOn)
+		}
+		if recordEvents {
+			recordDrift(context, live, diff, failOn)
+		}
+		if baselineFile := cmd.Flag("baseline").Value.String(); crd.IsRef(baselineFile) && cmd.Flag("snapshot").Value.String() == "" {
+			updateBaselineStatus(context, baselineFile, live, diff, failOn)
+		}
+
+		return nil
+	})
+
+	output := cmd.Flag("output").Value.String()
+	switch output {
+	case "wide":
+		for _, d := range data {
+			if d.Result == nil || len(d.Result.Differences) == 0 {
+				continue
+			}
+
+			fmt.Printf("==> %s <==\n", d.Context)
+			printDiffResult(*d.Result, output)
+			fmt.Println()
+		}
+		printDiffContextsWide(data)
+	case "json":
+		printJson(data)
+	case "yaml":
+		printYaml(data)
+	}
+
+	if failed(data) {
+		os.Exit(ExitRetrieval)
+	}
+
+	for _, d := range data {
+		if d.Result.Drift(failOn) {
+			os.Exit(ExitDrift)
+		}
+	}
+}
+
+// parseFailOn parses and validates the commaseparated change types
+func parseFailOn(s string) ([]string, error) {
+	ret := []string{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		switch c {
+		case "":
+			continue
+		case report.ChangeAdded, report.ChangeRemoved, report.ChangeModified, report.ChangeSchema, report.ChangeMetadata, report.ChangeUnknown,
+			report.ChangeRecreated, report.ChangeNewManager:
+			ret = append(ret, c)
+		default:
+			return nil, fmt.Errorf("unknown change type %s", c)
+		}
+	}
+
+	return ret, nil
+}
+
+// readNotifier reads the webhooks from file and creates a notifier
+func readNotifier(file string) (*notify.Notifier, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	config := notify.Config{}
+	err = yaml.UnmarshalStrict(raw, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	return notify.New(config)
+}
+
+// notifyDrift notifies the webhooks about the differences of the live report if
+// they are considered as drift, otherwise the notified differences are reset
+func notifyDrift(notifier *notify.Notifier, live *report.Report, result *report.DiffResult, failOn []string) {
+	p := notify.Payload{
+		Server:      live.Server,
+		Context:     live.Configuration.Context,
+		ScanStart:   live.ScanStart,
+		ScanEnd:     live.ScanEnd,
+		Differences: []report.DiffReport{},
+		Changes:     result.Changes,
+	}
+
+	if result.Drift(failOn) {
+		p.Differences = result.Differences
+	}
+
+	if err := notifier.Notify(p); err != nil {
+		log.Println("notification failed:", err)
+	}
+}
+
+// newEventRecorder creates a recorder of Kubernetes events in the cluster of
+// context, the kinds of the objects are looked up in resources
+func newEventRecorder(context string, resources []report.Resource) (*events.Recorder, *events.ClientRecorder, error) {
+	config, err := GetContextConfig(context)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host, _ := os.Hostname()
+	client := events.NewClientRecorder(clientset.CoreV1(), host)
+
+	return events.New(client, resources, events.Target()), client, nil
+}
+
+// recordDrift records Kubernetes events about the differences of the live
+// report which are considered as drift
+func recordDrift(context string, live *report.Report, result *report.DiffResult, failOn []string) {
+	drift := map[string]bool{}
+	for _, c := range failOn {
+		drift[c] = true
+	}
+
+	diffs := []report.DiffReport{}
+	for _, d := range result.Differences {
+		if drift[d.Kind] {
+			diffs = append(diffs, d)
+		}
+	}
+
+	if len(diffs) == 0 {
+		return
+	}
+
+	recorder, client, err := newEventRecorder(context, live.Resources)
+	if err != nil {
+		log.Println("recording events failed:", err)
+		return
+	}
+
+	recorder.Record(diffs)
+	if err := client.Err(); err != nil {
+		log.Println("recording events failed:", err)
+	}
+}
+
+// readIgnore reads and compiles the ignore rules from file
+func readIgnore(file string) (*report.Ignore, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ignore := &report.Ignore{}
+	err = yaml.UnmarshalStrict(raw, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ignore.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return ignore, nil
+}
+
+// printDiffResult prints the result in the output format wide, json or yaml
+func printDiffResult(result report.DiffResult, output string) {
+	switch output {
+	case "wide":
+		printDiffWide(result.Differences)
+		printIgnoreSummary(result.Ignored)
+	case "json":
+		printJson(result)
+	case "yaml":
+		printYaml(result)
+	}
+}
+
+// printIgnoreSummary prints how many differences have been ignored by which
+// rule
+func printIgnoreSummary(data []report.IgnoreCount) {
+	if len(data) == 0 {
+		return
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "\nIgnore rule\tIgnored")
+
+	for i, d := range data {
+		name := d.Rule.Description
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		fmt.Fprintf(w, "%s\t%d\n", name, d.Count)
+	}
+
+	w.Flush()
 }
 
 func printDiffWide(data []report.DiffReport) {
 	w := new(tabwriter.Writer)
 	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
-	fmt.Fprintln(w, "Element\tA\tB")
 
+	// The last changes are only printed if a journal or audit log annotated
+	// them
+	changed := false
 	for _, d := range data {
+		changed = changed || lastChange(d) != ""
+	}
+
+	if changed {
+		fmt.Fprintln(w, "Element\tA\tB\tLastChange")
+	} else {
+		fmt.Fprintln(w, "Element\tA\tB")
+	}
+
+	fields := []report.DiffReport{}
+	for _, d := range data {
+		if d.Path != "" {
+			fields = append(fields, d)
+			continue
+		}
+
+		if changed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Element, d.A, d.B, lastChange(d))
+			continue
+		}
+
 		fmt.Fprintf(w, "%s\t%s\t%s\n", d.Element, d.A, d.B)
 	}
 
 	w.Flush()
+
+	printFieldDiffs(fields)
+}
+
+// lastChange returns the last recorded change of the object of d from the
+// journal or else the audit log, empty if none is known
+func lastChange(d report.DiffReport) string {
+	switch {
+	case d.LastChange != nil:
+		return d.LastChange.String()
+	case len(d.AuditEvents) != 0:
+		return d.AuditEvents[len(d.AuditEvents)-1].String()
+	}
+
+	return ""
+}
+
+// printFieldDiffs prints field level differences of object contents as
+// unified diff, grouped by object
+func printFieldDiffs(data []report.DiffReport) {
+	object := ""
+	for _, d := range data {
+		o := strings.TrimSuffix(d.Element, ".Content."+d.Path)
+		if o != object {
+			object = o
+			fmt.Printf("\n--- a/%s\n+++ b/%s\n", object, object)
+			if c := lastChange(d); c != "" {
+				fmt.Printf("# %s\n", c)
+			}
+		}
+
+		fmt.Printf("@@ %s @@\n", d.Path)
+		if d.A != "does not exist" {
+			fmt.Printf("-%s\n", d.A)
+		}
+		if d.B != "does not exist" {
+			fmt.Printf("+%s\n", d.B)
+		}
+	}
 }
@@ -2,36 +2,293 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/postfinance/kubewire/pkg/access"
+	"github.com/postfinance/kubewire/pkg/crd"
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/retrieval"
+	"github.com/postfinance/kubewire/pkg/store"
 	yaml "gopkg.in/yaml.v2"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+// Exit codes of kubewire
+const (
+	// ExitDrift signals that differences have been found
+	ExitDrift = 1
+	// ExitUsage signals invalid flags or input files
+	ExitUsage = 2
+	// ExitRetrieval signals that the cluster could not be scanned
+	ExitRetrieval = 3
+)
+
+// fatal logs v and exits with code
+func fatal(code int, v ...interface{}) {
+	log.Println(v...)
+	os.Exit(code)
+}
+
+// readReport reads a snapshot in yaml format from file
+func readReport(file string) (*report.Report, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &report.Report{}
+	err = yaml.Unmarshal(raw, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	return rep, nil
+}
+
+// loadReport reads a snapshot from file or, for references like @latest,
+// from the store
+func loadReport(file string) (*report.Report, error) {
+	return loadContextReport(file, "")
+}
+
+// loadContextReport reads a snapshot of the cluster of context from file, for
+// references like @latest from the store of the context or, for references like
+// kubewirebaseline/production, from the KubewireBaseline in the cluster
+func loadContextReport(file string, context string) (*report.Report, error) {
+	if crd.IsRef(file) {
+		c, err := baselineClient(context)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.Pull(crd.RefName(file))
+	}
+
+	if !store.IsRef(file) {
+		return readReport(file)
+	}
+
+	s, err := openContextStore(context)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Load(file)
+}
+
+// openStore opens the snapshot history store of the store flag
+func openStore() (*store.Store, error) {
+	return openContextStore("")
+}
+
+// openContextStore opens the snapshot history store of the cluster of
+// context, which is a subdirectory of the store named after the context. An
+// empty context opens the store itself
+func openContextStore(context string) (*store.Store, error) {
+	dir, err := rootCmd.PersistentFlags().GetString("store")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	if dir == "" {
+		return nil, errors.New("no snapshot store defined, use --store")
+	}
+
+	if context != "" {
+		dir = filepath.Join(dir, contextFile(context))
+	}
+
+	return store.Open(dir)
+}
+
+// baselineClient creates a client for the KubewireBaselines in the cluster of
+// context
+func baselineClient(context string) (*crd.Client, error) {
+	config, err := GetContextConfig(context)
+	if err != nil {
+		return nil, err
+	}
+
+	return crd.New(config)
+}
+
+// updateBaselineStatus writes the result of the comparison with the live
+// report to the status of the KubewireBaseline ref of the cluster of context.
+// Failures are only logged.
+func updateBaselineStatus(context, ref string, live *report.Report, result *report.DiffResult, failOn []string) {
+	c, err := baselineClient(context)
+	if err == nil {
+		err = c.SetStatus(crd.RefName(ref), crd.NewStatus(*live, *result, failOn))
+	}
+
+	if err != nil {
+		log.Println("updating the baseline status failed:", err)
+	}
+}
+
 func GetConfig() (*rest.Config, error) {
+	return GetContextConfig("")
+}
+
+// GetContextConfig returns the client config for the kubeconfig context, empty
+// for the one of the context flag
+func GetContextConfig(context string) (*rest.Config, error) {
 	kcfg, err := rootCmd.PersistentFlags().GetString("kubeconfig")
 	if err != nil {
 		panic(err) // This should never occure
 	}
 
-	if kcfg == "" && access.IsInCluster() {
-		return access.InCluster()
+	overrides := configOverrides()
+	if context != "" {
+		overrides.CurrentContext = context
+	}
+
+	var config *rest.Config
+	switch {
+	case kcfg == "" && overrides.CurrentContext == "" && access.IsInCluster():
+		config, err = access.InCluster(overrides)
+	case kcfg != "":
+		config, err = access.ForConfig(kcfg, overrides)
+	default:
+		config, err = access.Default(overrides)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.QPS, err = rootCmd.PersistentFlags().GetFloat32("qps")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	config.Burst, err = rootCmd.PersistentFlags().GetInt("burst")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	return config, nil
+}
+
+// configOverrides returns the kubeconfig overrides of the authentication and
+// connection flags
+func configOverrides() *clientcmd.ConfigOverrides {
+	flags := rootCmd.PersistentFlags()
+	overrides := &clientcmd.ConfigOverrides{}
+
+	var err error
+	overrides.CurrentContext = rootContext()
+
+	overrides.AuthInfo.Impersonate, err = flags.GetString("as")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	overrides.AuthInfo.ImpersonateGroups, err = flags.GetStringArray("as-group")
+	if err != nil {
+		panic(err) // This should never occure
 	}
 
-	if kcfg != "" {
-		return access.ForConfig(kcfg)
+	overrides.AuthInfo.Token, err = flags.GetString("token")
+	if err != nil {
+		panic(err) // This should never occure
 	}
 
-	return access.Default()
+	overrides.ClusterInfo.Server, err = flags.GetString("server")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	overrides.ClusterInfo.CertificateAuthority, err = flags.GetString("certificate-authority")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	overrides.ClusterInfo.InsecureSkipTLSVerify, err = flags.GetBool("insecure-skip-tls-verify")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	timeout, err := flags.GetDuration("request-timeout")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+	if timeout != 0 {
+		overrides.Timeout = timeout.String()
+	}
+
+	return overrides
+}
+
+// rootContext returns the kubeconfig context of the context flag
+func rootContext() string {
+	context, err := rootCmd.PersistentFlags().GetString("context")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	return context
+}
+
+// strict returns true if the retrieval should abort on the first error
+func strict() bool {
+	strict, err := rootCmd.PersistentFlags().GetBool("strict")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	return strict
+}
+
+// scanOptions returns the retrieval options for the scanning configuration conf
+func scanOptions(conf report.Configuration) retrieval.Options {
+	concurrency, err := rootCmd.PersistentFlags().GetInt("concurrency")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	pageSize, err := rootCmd.PersistentFlags().GetInt64("page-size")
+	if err != nil {
+		panic(err) // This should never occure
+	}
+
+	return retrieval.Options{
+		PreferredVersions: conf.PreferredVersions,
+		ContentHash:       conf.ContentHash,
+		Content:           conf.Content,
+		Metadata:          conf.Metadata,
+		Labels:            conf.Labels,
+		Annotations:       conf.Annotations,
+		Concurrency:       concurrency,
+		PageSize:          pageSize,
+		Strict:            strict(),
+	}
+}
+
+// marshal encodes data in the output format json or yaml
+func marshal(data interface{}, output string) ([]byte, error) {
+	if output == "json" {
+		return json.Marshal(data)
+	}
+
+	return yaml.Marshal(data)
 }
 
 func printJson(data interface{}) {
 	enc := json.NewEncoder(os.Stdout)
-	enc.Encode(data)
+	if err := enc.Encode(data); err != nil {
+		fatal(ExitUsage, "Could not encode json:", err)
+	}
 }
 
 func printYaml(data interface{}) {
 	enc := yaml.NewEncoder(os.Stdout)
-	enc.Encode(data)
+	if err := enc.Encode(data); err != nil {
+		fatal(ExitUsage, "Could not encode yaml:", err)
+	}
 }
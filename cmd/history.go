@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Manage the snapshot history store",
+	Long: `Lists, shows, compares and prunes the snapshots saved by
+'snapshot --store'. Snapshots are referenced by their ID, '@latest' for
+the newest snapshot or '@baseline' for the one marked as baseline.`,
+}
+
+// historyListCmd represents the history list command
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the stored snapshots",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := openStore()
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		data, err := s.List()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		switch cmd.Flag("output").Value.String() {
+		case "wide":
+			printHistoryWide(data)
+		case "json":
+			printJson(data)
+		case "yaml":
+			printYaml(data)
+		default:
+			fatal(ExitUsage, "Unknown output format", cmd.Flag("output").Value.String())
+		}
+	},
+}
+
+// historyShowCmd represents the history show command
+var historyShowCmd = &cobra.Command{
+	Use:   "show ID",
+	Short: "Print a stored snapshot",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := openStore()
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		rep, err := s.Load(args[0])
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		switch cmd.Flag("output").Value.String() {
+		case "json":
+			printJson(rep)
+		case "yaml":
+			printYaml(rep)
+		default:
+			fatal(ExitUsage, "Unknown output format", cmd.Flag("output").Value.String())
+		}
+	},
+}
+
+// historyDiffCmd represents the history diff command
+var historyDiffCmd = &cobra.Command{
+	Use:   "diff ID1 ID2",
+	Short: "Compare two stored snapshots",
+	Long: `Compares two stored snapshots the same way as 'diff' does,
+including its exit codes.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		output := cmd.Flag("output").Value.String()
+		if output != "wide" && output != "json" && output != "yaml" {
+			fatal(ExitUsage, "Unknown output format", output)
+		}
+
+		failOn, err := parseFailOn(cmd.Flag("fail-on").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		var ignore *report.Ignore
+		if ignoreFile := cmd.Flag("ignore").Value.String(); ignoreFile != "" {
+			ignore, err = readIgnore(ignoreFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		s, err := openStore()
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		a, err := s.Load(args[0])
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		b, err := s.Load(args[1])
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		result := report.DiffReports(*a, *b, ignore)
+		printDiffResult(result, output)
+
+		if result.Drift(failOn) {
+			os.Exit(ExitDrift)
+		}
+	},
+}
+
+// historyPruneCmd represents the history prune command
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old snapshots",
+	Long: `Removes the snapshots which are neither one of the newest 'keep'
+nor younger than 'older-than'. The baseline is never removed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		keep, err := cmd.Flags().GetInt("keep")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		olderThan, err := cmd.Flags().GetDuration("older-than")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if keep <= 0 && olderThan <= 0 {
+			fatal(ExitUsage, "at least one of --keep and --older-than is required")
+		}
+
+		s, err := openStore()
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		removed, err := s.Prune(keep, olderThan, time.Now())
+		for _, id := range removed {
+			fmt.Println("removed", id)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+// historyBaselineCmd represents the history baseline command
+var historyBaselineCmd = &cobra.Command{
+	Use:   "baseline ID",
+	Short: "Mark a stored snapshot as baseline",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := openStore()
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		err = s.SetBaseline(args[0])
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyListCmd, historyShowCmd, historyDiffCmd, historyPruneCmd, historyBaselineCmd)
+
+	historyListCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+
+	historyShowCmd.Flags().StringP("output", "o", "yaml", "Output format: json|yaml")
+
+	historyDiffCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+	historyDiffCmd.Flags().StringP("ignore", "i", "", "File in yaml format with rules for differences to ignore")
+	historyDiffCmd.Flags().String("fail-on", strings.Join(report.DefaultFailOn, ","), "Change types which are considered as drift, commaseparated: added|removed|modified|resource-schema|metadata|unknown|recreated|new-field-manager")
+
+	historyPruneCmd.Flags().Int("keep", 0, "Number of the newest snapshots to keep, 0 to disable")
+	historyPruneCmd.Flags().Duration("older-than", 0, "Remove only snapshots older than this, e.g. 720h, 0 to disable")
+}
+
+func printHistoryWide(data []store.Entry) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "ID\tTime\tServer\tResourceObjects\tBaseline")
+
+	for _, e := range data {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%t\n", e.ID, e.Time.Format(time.RFC3339), e.Server, e.ResourceObjects, e.Baseline)
+	}
+
+	w.Flush()
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
@@ -32,18 +33,61 @@ These namespaces can be customized with the 'namespaces' flag.`,
 			namespaces = []string{}
 		}
 
-		data, err := retrieval.ResourceObjects(clientset, namespaces)
+		contentHash, err := cmd.Flags().GetBool("content-hash")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		content, err := cmd.Flags().GetBool("content")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		timings, err := cmd.Flags().GetBool("timings")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		preferred, err := cmd.Flags().GetBool("preferred-versions")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		data, err := retrieval.ResourceObjects(clientset, namespaces, scanOptions(report.Configuration{ContentHash: contentHash, Content: content, PreferredVersions: preferred}))
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		for _, e := range data.Errors {
+			log.Println(e)
+		}
+
+		if timings {
+			// Slowest first
+			sort.SliceStable(data.Timings, func(i, j int) bool {
+				return data.Timings[i].Duration > data.Timings[j].Duration
+			})
+		}
+
 		switch cmd.Flag("output").Value.String() {
 		case "wide":
-			printResourceObjectsWide(data)
+			if timings {
+				printTimingsWide(data.Timings)
+			} else {
+				printResourceObjectsWide(data.ResourceObjects)
+			}
 		case "json":
-			printJson(data)
+			if timings {
+				printJson(data.Timings)
+			} else {
+				printJson(data.ResourceObjects)
+			}
 		case "yaml":
-			printYaml(data)
+			if timings {
+				printYaml(data.Timings)
+			} else {
+				printYaml(data.ResourceObjects)
+			}
 		default:
 			log.Fatalf("Unknown output format %s", cmd.Flag("output").Value.String())
 		}
@@ -55,6 +99,22 @@ func init() {
 
 	resourceobjectsCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
 	resourceobjectsCmd.Flags().StringP("namespaces", "n", "default,kube-public,kube-system", "Namespaces to scrape, commaseparated")
+	resourceobjectsCmd.Flags().Bool("preferred-versions", true, "List only the preferred version of every API group")
+	resourceobjectsCmd.Flags().Bool("content-hash", false, "Record a fingerprint of every object")
+	resourceobjectsCmd.Flags().Bool("content", false, "Record the content of every object, Secret data is redacted")
+	resourceobjectsCmd.Flags().Bool("timings", false, "List how long it took to list the objects of every resource instead, slowest first")
+}
+
+func printTimingsWide(data []report.Timing) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "GroupVersion\tResource\tNamespace\tDuration\tObjects")
+
+	for _, d := range data {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", d.GroupVersion, d.Resource, d.Namespace, d.Duration, d.Objects)
+	}
+
+	w.Flush()
 }
 
 func printResourceObjectsWide(data []report.ResourceObject) {
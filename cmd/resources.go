@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/retrieval"
+	"github.com/spf13/cobra"
+)
+
+// resourcesCmd represents the resources command
+var resourcesCmd = &cobra.Command{
+	Use:   "resources",
+	Short: "List API resources",
+	Long: `List all API resources served by a Kubernetes cluster,
+including the ones defined by CustomResourceDefinitions and aggregated APIs.
+The list can be narrowed down with the 'group', 'namespaced' and 'verbs' flags.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		clientset, err := GetConfig()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		preferred, err := cmd.Flags().GetBool("preferred-versions")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		data, err := retrieval.Resources(clientset, retrieval.Options{PreferredVersions: preferred})
+		if err != nil && (strict() || !retrieval.IsPartialError(err)) {
+			log.Fatalln(err)
+		} else if err != nil {
+			log.Println(err)
+		}
+
+		data, err = filterResources(data, cmd.Flag("group").Value.String(), cmd.Flag("namespaced").Value.String(), cmd.Flag("verbs").Value.String())
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		switch cmd.Flag("output").Value.String() {
+		case "wide":
+			printResourcesWide(data)
+		case "json":
+			printJson(data)
+		case "yaml":
+			printYaml(data)
+		default:
+			log.Fatalf("Unknown output format %s", cmd.Flag("output").Value.String())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resourcesCmd)
+
+	resourcesCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+	resourcesCmd.Flags().StringP("group", "g", "", "Only list resources of this API group, use 'core' for the legacy group")
+	resourcesCmd.Flags().String("namespaced", "", "Only list namespaced (true) or global (false) resources, empty for both")
+	resourcesCmd.Flags().Bool("preferred-versions", false, "Only list the preferred version of every API group")
+	resourcesCmd.Flags().String("verbs", "", "Only list resources supporting all of these verbs, commaseparated")
+}
+
+// filterResources returns the resources matching group, namespaced and verbs.
+// Empty filter values match everything
+func filterResources(data []report.Resource, group, namespaced, verbs string) ([]report.Resource, error) {
+	var namespacedFilter *bool
+	if namespaced != "" {
+		b, err := strconv.ParseBool(namespaced)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for namespaced: %s", namespaced)
+		}
+		namespacedFilter = &b
+	}
+
+	// The legacy core group is empty, so it needs its own name on the command line
+	groupSet := group != ""
+	if group == "core" {
+		group = ""
+	}
+
+	verbList := []string{}
+	for _, v := range strings.Split(verbs, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			verbList = append(verbList, v)
+		}
+	}
+
+	ret := []report.Resource{}
+outer:
+	for _, r := range data {
+		if groupSet {
+			g, _ := report.SplitGroupVersionSafe(r.GroupVersion)
+			if g != group {
+				continue
+			}
+		}
+
+		if namespacedFilter != nil && r.Namespaced != *namespacedFilter {
+			continue
+		}
+
+		for _, v := range verbList {
+			if !r.HasVerb(v) {
+				continue outer
+			}
+		}
+
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
+
+func printResourcesWide(data []report.Resource) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "GroupVersion\tKind\tName\tNamespaced\tVerbs")
+
+	for _, d := range data {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%v\n", d.GroupVersion, d.Kind, d.Name, d.Namespaced, d.Verbs)
+	}
+
+	w.Flush()
+}
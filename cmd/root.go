@@ -28,7 +28,7 @@ paths for a kubeconfig. Either case can be overriden by setting the 'kubeconfig'
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(ExitUsage)
 	}
 }
 
@@ -36,4 +36,18 @@ func init() {
 	rootCmd.Version = Version
 
 	rootCmd.PersistentFlags().StringP("kubeconfig", "k", "", "absolute path to the kubeconfig file")
+	rootCmd.PersistentFlags().String("context", "", "kubeconfig context to use, empty for the current context")
+	rootCmd.PersistentFlags().String("as", "", "user to impersonate e.g. system:serviceaccount:kube-system:kubewire")
+	rootCmd.PersistentFlags().StringArray("as-group", []string{}, "group to impersonate, can be repeated")
+	rootCmd.PersistentFlags().String("token", "", "bearer token for the authentication to the API server")
+	rootCmd.PersistentFlags().String("server", "", "address and port of the API server")
+	rootCmd.PersistentFlags().String("certificate-authority", "", "path to a cert file for the certificate authority")
+	rootCmd.PersistentFlags().Bool("insecure-skip-tls-verify", false, "do not verify the certificate of the API server, this makes the connection insecure")
+	rootCmd.PersistentFlags().Duration("request-timeout", 0, "timeout of a single request to the API server, 0 for none")
+	rootCmd.PersistentFlags().Int("concurrency", 4, "maximum number of parallel list requests")
+	rootCmd.PersistentFlags().Bool("strict", false, "abort on the first API group which can not be discovered or resource which can not be listed")
+	rootCmd.PersistentFlags().Int64("page-size", 500, "maximum number of objects per list request, 0 to list all at once")
+	rootCmd.PersistentFlags().Float32("qps", 50, "maximum queries per second to the API server")
+	rootCmd.PersistentFlags().Int("burst", 100, "maximum burst of queries to the API server")
+	rootCmd.PersistentFlags().String("store", "", "directory of the snapshot history store")
 }
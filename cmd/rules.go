@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/postfinance/kubewire/pkg/crd"
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/rules"
+	"github.com/postfinance/kubewire/pkg/store"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// rulesCmd represents the rules command
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Evaluate rules with expressions over snapshots",
+}
+
+// rulesCheckCmd represents the rules check command
+var rulesCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Evaluate the rules for a snapshot or the live cluster",
+	Long: `Evaluates the expressions of the rules for every resource object and
+for the whole report of a snapshot or the live cluster. The expressions are
+written in the Common Expression Language (CEL) with the string extensions. With
+--baseline the objects know their changes since the baseline, so that e.g. new
+webhook configurations can be found, and the removed objects are evaluated as
+well.
+
+Exits with 1 if there are findings of the severities of --fail-on.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output := cmd.Flag("output").Value.String()
+		if output != "wide" && output != "json" && output != "yaml" {
+			fatal(ExitUsage, "Unknown output format", output)
+		}
+
+		failOn, err := parseSeverities(cmd.Flag("fail-on").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		set, err := readRules(cmd.Flag("rules").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		var baseline *report.Report
+		if baselineFile := cmd.Flag("baseline").Value.String(); baselineFile != "" {
+			baseline, err = loadReport(baselineFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		var rep *report.Report
+		if snapshotFile := cmd.Flag("snapshot").Value.String(); snapshotFile != "" {
+			rep, err = loadReport(snapshotFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		} else {
+			var conf report.Configuration
+			if baseline != nil {
+				conf = baseline.Configuration
+			} else {
+				namespaces := strings.Split(cmd.Flag("namespaces").Value.String(), ",")
+				if len(namespaces) == 1 && namespaces[0] == "" {
+					namespaces = []string{}
+				}
+
+				content, err := cmd.Flags().GetBool("content")
+				if err != nil {
+					panic(err) // This should never occure
+				}
+
+				conf = report.Configuration{Namespaces: namespaces, PreferredVersions: true, Content: content}
+			}
+
+			rep, err = GetReport(conf)
+			if err != nil {
+				fatal(ExitRetrieval, err)
+			}
+		}
+
+		result := set.Evaluate(*rep, baseline)
+		for _, e := range result.Errors {
+			log.Println(e)
+		}
+
+		switch output {
+		case "wide":
+			printFindingsWide(result.Findings)
+		case "json":
+			printJson(result)
+		case "yaml":
+			printYaml(result)
+		}
+
+		if result.Count(failOn) != 0 {
+			os.Exit(ExitDrift)
+		}
+	},
+}
+
+// rulesTestCmd represents the rules test command
+var rulesTestCmd = &cobra.Command{
+	Use:   "test FILE...",
+	Short: "Verify the rules against the snapshots of their tests",
+	Long: `Evaluates the rules of every file for the snapshots and baselines of its
+tests and compares the findings with the expected ones. Relative snapshot files
+are resolved in the directory of the rules file.
+
+Exits with 1 if a test fails.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		for _, file := range args {
+			set, err := readRules(file)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+
+			for i, test := range set.Tests {
+				name := test.Description
+				if name == "" {
+					name = fmt.Sprintf("#%d", i+1)
+				}
+
+				missing, unexpected, err := runRulesTest(set, test, filepath.Dir(file))
+				if err != nil {
+					fatal(ExitUsage, fmt.Sprintf("%s: test %s: %s", file, name, err))
+				}
+
+				if len(missing) == 0 && len(unexpected) == 0 {
+					fmt.Printf("ok\t%s: %s\n", file, name)
+					continue
+				}
+
+				failed = true
+				fmt.Printf("FAIL\t%s: %s\n", file, name)
+				for _, f := range missing {
+					fmt.Printf("\tmissing:    %s\n", f)
+				}
+				for _, f := range unexpected {
+					fmt.Printf("\tunexpected: %s\n", f)
+				}
+			}
+		}
+
+		if failed {
+			os.Exit(ExitDrift)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rulesCmd)
+	rulesCmd.AddCommand(rulesCheckCmd)
+	rulesCmd.AddCommand(rulesTestCmd)
+
+	rulesCheckCmd.Flags().StringP("rules", "r", "rules.yaml", "File in yaml format with the rules")
+	rulesCheckCmd.Flags().StringP("snapshot", "s", "", "Snapshot in yaml format or store reference e.g. @latest to evaluate, empty to scan the live cluster")
+	rulesCheckCmd.Flags().StringP("baseline", "b", "", "Baseline report in yaml format or store reference to find the changes of the objects")
+	rulesCheckCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+	rulesCheckCmd.Flags().String("fail-on", "warning,critical", "Severities of findings which fail the check, commaseparated: info|warning|critical")
+	rulesCheckCmd.Flags().StringP("namespaces", "n", "default,kube-public,kube-system", "Namespaces to scrape when scanning without baseline, commaseparated")
+	rulesCheckCmd.Flags().Bool("content", true, "Record the content of every object when scanning without baseline")
+}
+
+// readRules reads and compiles the rules from file
+func readRules(file string) (*rules.RuleSet, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &rules.RuleSet{}
+	err = yaml.UnmarshalStrict(raw, set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	err = set.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return set, nil
+}
+
+// runRulesTest evaluates the rules for the snapshot and baseline of test,
+// relative files are resolved in dir
+func runRulesTest(set *rules.RuleSet, test rules.Test, dir string) (missing, unexpected []string, err error) {
+	resolve := func(file string) string {
+		if store.IsRef(file) || crd.IsRef(file) || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+
+	rep, err := loadReport(resolve(test.Snapshot))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var baseline *report.Report
+	if test.Baseline != "" {
+		baseline, err = loadReport(resolve(test.Baseline))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	missing, unexpected = test.Verify(set.Evaluate(*rep, baseline))
+
+	return missing, unexpected, nil
+}
+
+// parseSeverities parses and validates the commaseparated severities
+func parseSeverities(s string) ([]string, error) {
+	ret := []string{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		switch c {
+		case "":
+			continue
+		case report.SeverityInfo, report.SeverityWarning, report.SeverityCritical:
+			ret = append(ret, c)
+		default:
+			return nil, fmt.Errorf("unknown severity %s", c)
+		}
+	}
+
+	return ret, nil
+}
+
+// printFindingsWide prints the findings as table
+func printFindingsWide(data []rules.Finding) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "Rule\tSeverity\tObject\tMessage")
+
+	for _, f := range data {
+		object := ""
+		if f.ResourceObject != nil {
+			object = f.ResourceObject.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Rule, f.Severity, object, f.Message)
+	}
+
+	w.Flush()
+}
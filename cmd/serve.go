@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/crd"
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Compare a live cluster periodically and expose Prometheus metrics",
+	Long: `Compares the live cluster with the baseline every interval like
+'diff' does and exposes the differences of the last scan as Prometheus
+metrics on /metrics. /healthz reports if the process is alive, /readyz if a
+scan has succeeded. A baseline loaded from a KubewireBaseline gets the result
+of every scan in its status.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil || interval <= 0 {
+			fatal(ExitUsage, "Invalid interval", cmd.Flag("interval").Value.String())
+		}
+
+		baseline, err := loadReport(cmd.Flag("baseline").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		var ignore *report.Ignore
+		if ignoreFile := cmd.Flag("ignore").Value.String(); ignoreFile != "" {
+			ignore, err = readIgnore(ignoreFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		s := server.New(*baseline, ignore, GetReport)
+		if baselineFile := cmd.Flag("baseline").Value.String(); crd.IsRef(baselineFile) {
+			s.OnScan(func(live *report.Report, result report.DiffResult) {
+				updateBaselineStatus("", baselineFile, live, &result, report.DefaultFailOn)
+			})
+		}
+		srv := &http.Server{
+			Addr:    cmd.Flag("listen").Value.String(),
+			Handler: s.Handler(),
+		}
+
+		// Run returns once the shutdown has drained the handlers and the scan
+		// in progress, if any, has finished
+		stop, done, scanned := make(chan struct{}), make(chan struct{}), make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			defer close(done)
+			<-signals
+			close(stop)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			srv.Shutdown(ctx)
+		}()
+
+		go func() {
+			defer close(scanned)
+			s.Run(interval, stop)
+		}()
+
+		err = srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalln(err)
+		}
+		<-done
+		<-scanned
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringP("baseline", "b", "baseline.yaml", "Baseline report in yaml format, store reference e.g. @baseline or kubewirebaseline/NAME")
+	serveCmd.Flags().StringP("ignore", "i", "", "File in yaml format with rules for differences to ignore")
+	serveCmd.Flags().Duration("interval", 5*time.Minute, "Interval between the scans of the cluster")
+	serveCmd.Flags().String("listen", ":8080", "Address to serve the metrics and health checks on")
+}
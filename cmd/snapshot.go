@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/postfinance/kubewire/pkg/access"
 	"github.com/postfinance/kubewire/pkg/report"
 	"github.com/postfinance/kubewire/pkg/retrieval"
 	"github.com/spf13/cobra"
@@ -17,7 +23,14 @@ var snapshotCmd = &cobra.Command{
 	Long: `Takes a snapshot of cluster resources and objects
 that may be used by 'diff' to compare cluster states.
 The output is either in json or yaml so that it can be processed by
-other tools and also allows it to be stored in a database.`,
+other tools and also allows it to be stored in a database.
+If --store is set, the snapshot is saved in the history store instead and its
+ID is printed.
+
+With --contexts or --all-contexts the clusters of multiple kubeconfig contexts
+are scanned in parallel. Their snapshots are written to files named after the
+context in --output-dir or saved in a subdirectory of the store named after the
+context.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Split namespaces flag
 		namespaces := strings.Split(cmd.Flag("namespaces").Value.String(), ",")
@@ -25,12 +38,78 @@ other tools and also allows it to be stored in a database.`,
 			namespaces = []string{}
 		}
 
+		contentHash, err := cmd.Flags().GetBool("content-hash")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		content, err := cmd.Flags().GetBool("content")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		preferred, err := cmd.Flags().GetBool("preferred-versions")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		metadata, err := cmd.Flags().GetBool("metadata")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		labels, err := parsePatterns(cmd.Flag("labels").Value.String())
+		if err != nil {
+			fatal(ExitUsage, "--labels:", err)
+		}
+
+		annotations, err := parsePatterns(cmd.Flag("annotations").Value.String())
+		if err != nil {
+			fatal(ExitUsage, "--annotations:", err)
+		}
+
+		conf := report.Configuration{
+			Namespaces:        namespaces,
+			PreferredVersions: preferred,
+			ContentHash:       contentHash,
+			Content:           content,
+			Metadata:          metadata || len(labels) != 0 || len(annotations) != 0,
+			Labels:            labels,
+			Annotations:       annotations,
+		}
+
+		contexts, err := selectedContexts(cmd)
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		if contexts != nil {
+			snapshotContexts(cmd, contexts, conf)
+			return
+		}
+
 		// Create report
-		rep, err := GetReport(namespaces)
+		rep, err := GetReport(conf)
 		if err != nil {
 			log.Fatalln(err)
 		}
 
+		// Storing
+		if dir, _ := rootCmd.PersistentFlags().GetString("store"); dir != "" {
+			s, err := openStore()
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			id, err := s.Save(*rep)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			fmt.Println(id)
+			return
+		}
+
 		// Printing
 		switch cmd.Flag("output").Value.String() {
 		case "json":
@@ -48,20 +127,105 @@ func init() {
 
 	snapshotCmd.Flags().StringP("output", "o", "yaml", "Output format: json|yaml")
 	snapshotCmd.Flags().StringP("namespaces", "n", "default,kube-public,kube-system", "Namespaces to scrape, commaseparated")
+	snapshotCmd.Flags().Bool("content-hash", false, "Record a fingerprint of every object to detect modifications")
+	snapshotCmd.Flags().Bool("preferred-versions", true, "Scan only the preferred version of every API group")
+	snapshotCmd.Flags().Bool("content", false, "Record the content of every object for field level diffs, Secret data is redacted")
+	snapshotCmd.Flags().Bool("metadata", false, "Record the UID, creation timestamp, generation, owners and field managers of every object")
+	snapshotCmd.Flags().String("labels", "", "Glob patterns of the label keys to record in the metadata, commaseparated e.g. app.kubernetes.io/*, implies --metadata")
+	snapshotCmd.Flags().String("annotations", "", "Glob patterns of the annotation keys to record in the metadata, commaseparated, implies --metadata")
+	snapshotCmd.Flags().String("output-dir", ".", "Directory to write the snapshots of multiple contexts to")
+	addContextsFlags(snapshotCmd)
+}
+
+// snapshotContexts takes the snapshots of the clusters of multiple contexts in
+// parallel and prints a summary
+func snapshotContexts(cmd *cobra.Command, contexts []string, conf report.Configuration) {
+	output := cmd.Flag("output").Value.String()
+	if output != "json" && output != "yaml" {
+		fatal(ExitUsage, "Unknown output format", output)
+	}
+
+	dir, _ := rootCmd.PersistentFlags().GetString("store")
+	outputDir := cmd.Flag("output-dir").Value.String()
+
+	data := forContexts(contexts, func(context string, result *contextResult) error {
+		rep, err := GetContextReport(context, conf)
+		if err != nil {
+			return err
+		}
+
+		if dir != "" {
+			s, err := openContextStore(context)
+			if err != nil {
+				return err
+			}
+
+			result.Snapshot, err = s.Save(*rep)
+			return err
+		}
+
+		raw, err := marshal(rep, output)
+		if err != nil {
+			return err
+		}
+
+		result.Snapshot = filepath.Join(outputDir, contextFile(context)+"."+output)
+		return ioutil.WriteFile(result.Snapshot, raw, 0644)
+	})
+
+	printSnapshotContextsWide(data)
+
+	if failed(data) {
+		os.Exit(ExitRetrieval)
+	}
+}
+
+// parsePatterns parses and validates the commaseparated glob patterns
+func parsePatterns(s string) ([]string, error) {
+	ret := []string{}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %s", p, err)
+		}
+		ret = append(ret, p)
+	}
+
+	if len(ret) == 0 {
+		return nil, nil
+	}
+
+	return ret, nil
+}
+
+// GetReport creates a report using the scanning configuration conf
+func GetReport(conf report.Configuration) (*report.Report, error) {
+	return GetContextReport("", conf)
 }
 
-// GetReport creates a report
-func GetReport(namespaces []string) (*report.Report, error) {
+// GetContextReport creates a report of the cluster of the kubeconfig context,
+// empty for the one of the context flag, using the scanning configuration conf
+func GetContextReport(context string, conf report.Configuration) (*report.Report, error) {
+	if context == "" {
+		context = rootContext()
+	}
+
 	rep := &report.Report{}
 	rep.ScanStart = time.Now()
+	rep.Configuration = conf
 	rep.Configuration.KubewireVersion = Version
-	rep.Configuration.Namespaces = namespaces
+	rep.Configuration.Context = context
 
 	// Setup
-	clientset, err := GetConfig()
+	clientset, err := GetContextConfig(context)
 	if err != nil {
 		return nil, err
 	}
+	rep.Configuration.Identity, rep.Configuration.Groups = access.Identity(clientset)
 
 	// Server
 	data, err := retrieval.ServerVersion(clientset)
@@ -70,19 +234,22 @@ func GetReport(namespaces []string) (*report.Report, error) {
 	}
 	rep.Server = data
 
-	// Resources
-	data2, err := retrieval.Resources(clientset)
-	if err != nil {
+	// Resources, the failed API groups are recorded by the retrieval of the
+	// resource objects unless strict
+	data2, err := retrieval.Resources(clientset, scanOptions(conf))
+	if err != nil && (strict() || !retrieval.IsPartialError(err)) {
 		return nil, err
 	}
 	rep.Resources = data2
 
 	// Resource objects
-	data3, err := retrieval.ResourceObjects(clientset, namespaces)
+	data3, err := retrieval.ResourceObjects(clientset, conf.Namespaces, scanOptions(conf))
 	if err != nil {
 		return nil, err
 	}
-	rep.ResourceObjects = data3
+	rep.ResourceObjects = data3.ResourceObjects
+	rep.Timings = data3.Timings
+	rep.Errors = data3.Errors
 
 	rep.ScanEnd = time.Now()
 
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/events"
+	"github.com/postfinance/kubewire/pkg/notify"
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/retrieval"
+	"github.com/postfinance/kubewire/pkg/watcher"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+// notifyQueueSize is the number of notifications which may be pending while
+// the webhooks are notified
+const notifyQueueSize = 100
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch a live cluster for differences to a baseline",
+	Long: `Watches all listable resource objects of a live cluster and reports
+every object which appears, disappears or changes compared to the baseline
+as soon as it happens. The configuration of the baseline report, e.g. the
+namespaces, is used for watching the cluster. The API resources are discovered
+periodically, so that new resources e.g. of CustomResourceDefinitions are
+watched as well.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output := cmd.Flag("output").Value.String()
+		if output != "wide" && output != "json" && output != "yaml" {
+			fatal(ExitUsage, "Unknown output format", output)
+		}
+
+		interval, err := cmd.Flags().GetDuration("discovery-interval")
+		if err != nil || interval <= 0 {
+			fatal(ExitUsage, "Invalid discovery interval", cmd.Flag("discovery-interval").Value.String())
+		}
+
+		baseline, err := readReport(cmd.Flag("baseline").Value.String())
+		if err != nil {
+			fatal(ExitUsage, err)
+		}
+
+		var ignore *report.Ignore
+		if ignoreFile := cmd.Flag("ignore").Value.String(); ignoreFile != "" {
+			ignore, err = readIgnore(ignoreFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		var notifier *notify.Notifier
+		if notifyFile := cmd.Flag("notify").Value.String(); notifyFile != "" {
+			notifier, err = readNotifier(notifyFile)
+			if err != nil {
+				fatal(ExitUsage, err)
+			}
+		}
+
+		config, err := GetConfig()
+		if err != nil {
+			fatal(ExitRetrieval, err)
+		}
+
+		// The notifications are sent in the background, so that slow webhooks
+		// do not delay the watch
+		var queue *notify.Queue
+		var server report.Server
+		if notifier != nil {
+			server, err = retrieval.ServerVersion(config)
+			if err != nil {
+				fatal(ExitRetrieval, err)
+			}
+
+			queue = notify.NewQueue(notifier, notifyQueueSize, func(err error) {
+				log.Println("notification failed:", err)
+			})
+		}
+
+		var recorder *events.Recorder
+		var client *events.ClientRecorder
+		if recordEvents, _ := cmd.Flags().GetBool("events"); recordEvents {
+			clientset, err := kubernetes.NewForConfig(config)
+			if err != nil {
+				fatal(ExitRetrieval, err)
+			}
+
+			host, _ := os.Hostname()
+			client = events.NewClientRecorder(clientset.CoreV1(), host)
+			recorder = events.New(client, baseline.Resources, events.Target())
+		}
+
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		w := watcher.New(*baseline, ignore)
+		done := make(chan error, 1)
+		go func() {
+			done <- w.Run(config, interval, stop)
+		}()
+
+		for {
+			select {
+			case err := <-done:
+				if queue != nil {
+					queue.Close()
+				}
+				if err != nil {
+					fatal(ExitRetrieval, err)
+				}
+				return
+			case event := <-w.Events:
+				switch output {
+				case "wide":
+					printEventWide(event)
+				case "json":
+					printJson(event)
+				case "yaml":
+					printYaml(event)
+				}
+
+				if queue != nil {
+					err := queue.Enqueue(notify.Payload{
+						Server:      server,
+						Context:     rootContext(),
+						ScanStart:   event.Time,
+						ScanEnd:     event.Time,
+						Differences: event.Differences,
+					})
+					if err != nil {
+						log.Println("notification failed:", err)
+					}
+				}
+
+				if recorder != nil {
+					recorder.Record(event.Differences)
+					if err := client.Err(); err != nil {
+						log.Println("recording events failed:", err)
+					}
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringP("baseline", "b", "baseline.yaml", "Baseline report in yaml format")
+	watchCmd.Flags().StringP("output", "o", "wide", "Output format: json|yaml|wide")
+	watchCmd.Flags().StringP("ignore", "i", "", "File in yaml format with rules for differences to ignore")
+	watchCmd.Flags().String("notify", "", "File in yaml format with webhooks to notify about differences")
+	watchCmd.Flags().Bool("events", false, "Record Kubernetes events on the objects which differ")
+	watchCmd.Flags().Duration("discovery-interval", 5*time.Minute, "Interval to discover new or removed API resources")
+}
+
+func printEventWide(event watcher.Event) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, ' ', 0)
+
+	for _, d := range event.Differences {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", event.Time.Format(time.RFC3339), d.Kind, d.Element, d.A, d.B)
+	}
+
+	w.Flush()
+}
@@ -2,6 +2,8 @@ package access
 
 import (
 	"os"
+	"sort"
+	"time"
 
 	// These are needed in order to support the authentication methods
 	_ "k8s.io/client-go/plugin/pkg/client/auth/azure"
@@ -11,6 +13,7 @@ import (
 	"k8s.io/client-go/rest"
 
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // IsInCluster returns true if the process is running in a Pod
@@ -21,29 +24,123 @@ func IsInCluster() bool {
 
 }
 
-// InCluster returns a REST configuration for using it inside a Pod
-func InCluster() (*rest.Config, error) {
-	return rest.InClusterConfig()
+// InCluster returns a REST configuration for using it inside a Pod with the
+// overrides of the server, the credentials, the TLS verification, the
+// impersonation and the timeout applied
+func InCluster(overrides *clientcmd.ConfigOverrides) (*rest.Config, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyOverrides(config, overrides); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// applyOverrides applies the overrides to the in cluster configuration config
+func applyOverrides(config *rest.Config, overrides *clientcmd.ConfigOverrides) error {
+	if overrides.ClusterInfo.Server != "" {
+		config.Host = overrides.ClusterInfo.Server
+	}
+
+	// The token of the service account is added by the wrapped transport
+	if overrides.AuthInfo.Token != "" {
+		config.BearerToken = overrides.AuthInfo.Token
+		config.WrapTransport = nil
+	}
+
+	if overrides.ClusterInfo.CertificateAuthority != "" {
+		config.TLSClientConfig.CAFile = overrides.ClusterInfo.CertificateAuthority
+		config.TLSClientConfig.CAData = nil
+	}
+
+	// A root certificate can not be combined with skipping the verification
+	if overrides.ClusterInfo.InsecureSkipTLSVerify {
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
+	}
+
+	config.Impersonate.UserName = overrides.AuthInfo.Impersonate
+	config.Impersonate.Groups = overrides.AuthInfo.ImpersonateGroups
+
+	if overrides.Timeout != "" {
+		timeout, err := time.ParseDuration(overrides.Timeout)
+		if err != nil {
+			return err
+		}
+		config.Timeout = timeout
+	}
+
+	return nil
 }
 
-// ForConfig returns a client config from the provided file path
-func ForConfig(kcfg string) (*rest.Config, error) {
+// ForConfig returns a client config from the provided file path with the
+// overrides applied e.g. another context
+func ForConfig(kcfg string, overrides *clientcmd.ConfigOverrides) (*rest.Config, error) {
 	fileConfig, err := clientcmd.LoadFromFile(kcfg)
 	if err != nil {
 		return nil, err
 	}
 
-	configOverrides := &clientcmd.ConfigOverrides{}
-	kubeConfig := clientcmd.NewDefaultClientConfig(*fileConfig, configOverrides)
+	kubeConfig := clientcmd.NewDefaultClientConfig(*fileConfig, overrides)
 
 	return kubeConfig.ClientConfig()
 }
 
 // Default returns the client config using the default kubeconfig search paths
-func Default() (*rest.Config, error) {
+// with the overrides applied e.g. another context
+func Default(overrides *clientcmd.ConfigOverrides) (*rest.Config, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
 
 	return kubeConfig.ClientConfig()
 }
+
+// SelectsCluster returns true if the overrides select a cluster or credentials
+// instead of the ones of the current context
+func SelectsCluster(overrides *clientcmd.ConfigOverrides) bool {
+	return overrides.CurrentContext != "" || overrides.ClusterInfo.Server != "" ||
+		overrides.AuthInfo.Token != "" || overrides.ClusterInfo.CertificateAuthority != ""
+}
+
+// Contexts returns the sorted names of all contexts of the provided file path,
+// or of the default kubeconfig search paths if it is empty
+func Contexts(kcfg string) ([]string, error) {
+	config, err := loadConfig(kcfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for name := range config.Contexts {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+// CurrentContext returns the current context of the provided file path, or of
+// the default kubeconfig search paths if it is empty
+func CurrentContext(kcfg string) (string, error) {
+	config, err := loadConfig(kcfg)
+	if err != nil {
+		return "", err
+	}
+
+	return config.CurrentContext, nil
+}
+
+// loadConfig loads the kubeconfig of the provided file path, or of the default
+// kubeconfig search paths if it is empty
+func loadConfig(kcfg string) (*clientcmdapi.Config, error) {
+	if kcfg != "" {
+		return clientcmd.LoadFromFile(kcfg)
+	}
+
+	return clientcmd.NewDefaultClientConfigLoadingRules().Load()
+}
@@ -0,0 +1,59 @@
+package access
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// inClusterConfig returns a configuration like the one of a Pod
+func inClusterConfig() *rest.Config {
+	return &rest.Config{
+		Host:            "https://10.96.0.1:443",
+		TLSClientConfig: rest.TLSClientConfig{CAFile: "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"},
+		WrapTransport:   func(rt http.RoundTripper) http.RoundTripper { return rt },
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	config := inClusterConfig()
+	if err := applyOverrides(config, &clientcmd.ConfigOverrides{}); err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "https://10.96.0.1:443" || config.WrapTransport == nil || config.TLSClientConfig.CAFile == "" || config.Timeout != 0 {
+		t.Errorf("Got %+v, expected the in cluster configuration without overrides", config)
+	}
+
+	overrides := &clientcmd.ConfigOverrides{Timeout: "10s"}
+	overrides.ClusterInfo.Server = "https://kubernetes.example.com"
+	overrides.ClusterInfo.CertificateAuthority = "ca.crt"
+	overrides.AuthInfo.Token = "x"
+	overrides.AuthInfo.Impersonate = "system:serviceaccount:kube-system:kubewire"
+
+	config = inClusterConfig()
+	if err := applyOverrides(config, overrides); err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != overrides.ClusterInfo.Server || config.BearerToken != "x" || config.WrapTransport != nil ||
+		config.TLSClientConfig.CAFile != "ca.crt" || config.Impersonate.UserName != overrides.AuthInfo.Impersonate || config.Timeout != 10*time.Second {
+		t.Errorf("Got %+v, expected the overrides to be applied", config)
+	}
+
+	overrides = &clientcmd.ConfigOverrides{}
+	overrides.ClusterInfo.InsecureSkipTLSVerify = true
+
+	config = inClusterConfig()
+	if err := applyOverrides(config, overrides); err != nil {
+		t.Fatal(err)
+	}
+	if !config.TLSClientConfig.Insecure || config.TLSClientConfig.CAFile != "" {
+		t.Errorf("Got %+v, expected the verification to be skipped without root certificate", config.TLSClientConfig)
+	}
+
+	if err := applyOverrides(inClusterConfig(), &clientcmd.ConfigOverrides{Timeout: "x"}); err == nil {
+		t.Error("Expected an error for an invalid timeout")
+	}
+}
@@ -0,0 +1,67 @@
+package access
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+// Identity returns the user name and groups config authenticates or
+// impersonates as, as far as they can be determined without asking the API
+// server. These are the impersonated user, the subject of a service account
+// token, the basic auth user or the subject of the client certificate. An empty
+// name is returned for other authentication methods e.g. OIDC.
+func Identity(config *rest.Config) (string, []string) {
+	if config.Impersonate.UserName != "" {
+		return config.Impersonate.UserName, config.Impersonate.Groups
+	}
+
+	if config.BearerToken != "" {
+		return tokenSubject(config.BearerToken), nil
+	}
+
+	if config.Username != "" {
+		return config.Username, nil
+	}
+
+	certData := config.CertData
+	if len(certData) == 0 && config.CertFile != "" {
+		certData, _ = ioutil.ReadFile(config.CertFile)
+	}
+	if block, _ := pem.Decode(certData); block != nil {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			return cert.Subject.CommonName, cert.Subject.Organization
+		}
+	}
+
+	return "", nil
+}
+
+// tokenSubject returns the subject of a JWT e.g. of a service account token,
+// the signature is not verified
+func tokenSubject(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	claims := struct {
+		Sub string `json:"sub"`
+	}{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return ""
+	}
+
+	return claims.Sub
+}
@@ -0,0 +1,32 @@
+package access
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestIdentity(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"kubernetes/serviceaccount","sub":"system:serviceaccount:kube-system:kubewire"}`))
+
+	tests := []struct {
+		config *rest.Config
+		name   string
+		groups []string
+	}{
+		{&rest.Config{BearerToken: "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2lnbmF0dXJl"}, "system:serviceaccount:kube-system:kubewire", nil},
+		{&rest.Config{BearerToken: "opaque"}, "", nil},
+		{&rest.Config{BearerToken: "opaque", Impersonate: rest.ImpersonationConfig{UserName: "alice", Groups: []string{"admins"}}}, "alice", []string{"admins"}},
+		{&rest.Config{Username: "admin", Password: "secret"}, "admin", nil},
+		{&rest.Config{}, "", nil},
+	}
+
+	for _, test := range tests {
+		name, groups := Identity(test.config)
+		if name != test.name || !reflect.DeepEqual(groups, test.groups) {
+			t.Errorf("Got %s %v, expected %s %v", name, groups, test.name, test.groups)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package admission
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/journal"
+	admission_v1beta1 "k8s.io/api/admission/v1beta1"
+)
+
+// maxBody limits the size of an AdmissionReview, the API server sends at most
+// two objects
+const maxBody = 7 * 1024 * 1024
+
+// Recorder records the entries of the admission requests e.g. in a
+// journal.Journal
+type Recorder interface {
+	Append(e journal.Entry) error
+}
+
+// Handler serves a validating admission webhook, which records who creates,
+// updates or deletes the objects kubewire tracks. It only audits: every
+// request is allowed, even if it can not be recorded.
+type Handler struct {
+	recorder   Recorder
+	namespaces map[string]bool
+	now        func() time.Time
+}
+
+// New creates a Handler recording the changes of global objects and of the
+// objects in namespaces
+func New(recorder Recorder, namespaces []string) *Handler {
+	h := &Handler{
+		recorder:   recorder,
+		namespaces: map[string]bool{},
+		now:        time.Now,
+	}
+
+	for _, ns := range namespaces {
+		h.namespaces[ns] = true
+	}
+
+	return h
+}
+
+// ServeHTTP handles an AdmissionReview. The response has the apiVersion of the
+// request, so that admission.k8s.io/v1 and v1beta1 are supported.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := admission_v1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	if e, ok := h.entry(review.Request); ok {
+		if err := h.recorder.Append(e); err != nil {
+			log.Println("recording admission request failed:", err)
+		}
+	}
+
+	resp := admission_v1beta1.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: &admission_v1beta1.AdmissionResponse{
+			UID:     review.Request.UID,
+			Allowed: true,
+		},
+	}
+	if resp.APIVersion == "" {
+		resp.APIVersion = admission_v1beta1.SchemeGroupVersion.String()
+		resp.Kind = "AdmissionReview"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// entry returns the journal entry of req, false if it is not recorded
+func (h *Handler) entry(req *admission_v1beta1.AdmissionRequest) (journal.Entry, bool) {
+	switch {
+	case req.DryRun != nil && *req.DryRun:
+		return journal.Entry{}, false
+	case req.SubResource != "":
+		// e.g. status updates of controllers
+		return journal.Entry{}, false
+	}
+
+	switch req.Operation {
+	case admission_v1beta1.Create, admission_v1beta1.Update, admission_v1beta1.Delete:
+	default:
+		return journal.Entry{}, false
+	}
+
+	namespace := req.Namespace
+	if req.Resource.Group == "" && req.Resource.Resource == "namespaces" {
+		// Namespaces are global, but have their own name as namespace
+		namespace = ""
+	}
+	if namespace != "" && !h.namespaces[namespace] {
+		return journal.Entry{}, false
+	}
+
+	name := req.Name
+	if name == "" {
+		// The name is not set in the request if it is generated
+		name = objectName(req.Object.Raw)
+	}
+
+	groupVersion := req.Resource.Version
+	if req.Resource.Group != "" {
+		groupVersion = req.Resource.Group + "/" + req.Resource.Version
+	}
+
+	return journal.Entry{
+		Time:         h.now(),
+		User:         req.UserInfo.Username,
+		Groups:       req.UserInfo.Groups,
+		Operation:    string(req.Operation),
+		GroupVersion: groupVersion,
+		Resource:     req.Resource.Resource,
+		Namespace:    namespace,
+		Name:         name,
+		UID:          string(req.UID),
+	}, true
+}
+
+// objectName returns the name of the object raw in JSON format
+func objectName(raw []byte) string {
+	obj := struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}{}
+
+	json.Unmarshal(raw, &obj)
+
+	return obj.Metadata.Name
+}
@@ -0,0 +1,104 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/journal"
+	admission_v1beta1 "k8s.io/api/admission/v1beta1"
+)
+
+// fakeJournal records the entries in memory
+type fakeJournal struct {
+	entries []journal.Entry
+}
+
+func (f *fakeJournal) Append(e journal.Entry) error {
+	f.entries = append(f.entries, e)
+	return nil
+}
+
+// post posts the AdmissionReview fixture to h and returns the response
+func post(t *testing.T, h http.Handler, fixture string) (int, admission_v1beta1.AdmissionReview) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw)))
+
+	review := admission_v1beta1.AdmissionReview{}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil {
+			t.Fatalf("%s: %s", fixture, err)
+		}
+	}
+
+	return w.Code, review
+}
+
+func TestHandler(t *testing.T) {
+	j := &fakeJournal{}
+	h := New(j, []string{"default", "kube-system"})
+	now := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+
+	for _, tc := range []struct {
+		fixture    string
+		apiVersion string
+		uid        string
+	}{
+		{"create-namespace.json", "admission.k8s.io/v1", "705ab4f5-6393-11e8-b7cc-42010a800002"},
+		{"update-deployment.json", "admission.k8s.io/v1beta1", "9a1b2c3d-6393-11e8-b7cc-42010a800002"},
+		{"create-generated-name.json", "admission.k8s.io/v1", "b2c3d4e5-6393-11e8-b7cc-42010a800002"},
+		{"create-untracked-namespace.json", "admission.k8s.io/v1", "c3d4e5f6-6393-11e8-b7cc-42010a800002"},
+		{"update-status.json", "admission.k8s.io/v1", "d4e5f6a7-6393-11e8-b7cc-42010a800002"},
+		{"delete-dry-run.json", "admission.k8s.io/v1", "e5f6a7b8-6393-11e8-b7cc-42010a800002"},
+	} {
+		code, review := post(t, h, tc.fixture)
+		if code != http.StatusOK {
+			t.Errorf("%s: got status %d", tc.fixture, code)
+			continue
+		}
+
+		if review.APIVersion != tc.apiVersion || review.Kind != "AdmissionReview" || review.Response == nil || !review.Response.Allowed || string(review.Response.UID) != tc.uid {
+			t.Errorf("%s: got response %+v", tc.fixture, review)
+		}
+	}
+
+	exp := []journal.Entry{
+		{Time: now, User: "alice", Groups: []string{"system:authenticated"}, Operation: "CREATE", GroupVersion: "v1", Resource: "namespaces", Name: "appl-shouldnotbehere", UID: "705ab4f5-6393-11e8-b7cc-42010a800002"},
+		{Time: now, User: "system:serviceaccount:kube-system:deployer", Groups: []string{"system:serviceaccounts", "system:serviceaccounts:kube-system"}, Operation: "UPDATE", GroupVersion: "apps/v1", Resource: "deployments", Namespace: "kube-system", Name: "coredns", UID: "9a1b2c3d-6393-11e8-b7cc-42010a800002"},
+		{Time: now, User: "bob", Operation: "CREATE", GroupVersion: "v1", Resource: "configmaps", Namespace: "default", Name: "settings-x7k2p", UID: "b2c3d4e5-6393-11e8-b7cc-42010a800002"},
+	}
+
+	got, _ := json.Marshal(j.entries)
+	want, _ := json.Marshal(exp)
+	if string(got) != string(want) {
+		t.Errorf("Got entries\n%s\nexpected\n%s", got, want)
+	}
+}
+
+func TestHandlerInvalid(t *testing.T) {
+	h := New(&fakeJournal{}, nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"kind": "AdmissionReview"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Got status %d for a review without request", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Got status %d for GET", w.Code)
+	}
+}
@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+// MaxEvents limits the audit events attached to a difference, the latest
+// ones are kept
+const MaxEvents = 10
+
+// Event is the part of an audit.k8s.io/v1 event which is needed for the
+// correlation
+type Event struct {
+	Stage          string
+	Verb           string
+	User           UserInfo
+	SourceIPs      []string `json:"sourceIPs"`
+	UserAgent      string   `json:"userAgent"`
+	ObjectRef      *ObjectReference
+	ResponseStatus *struct {
+		Code int
+	}
+	ResponseObject *struct {
+		Metadata struct {
+			Name string
+		}
+	}
+	StageTimestamp time.Time
+}
+
+// UserInfo of an audit event
+type UserInfo struct {
+	Username string
+	Groups   []string
+}
+
+// ObjectReference of an audit event
+type ObjectReference struct {
+	Resource    string
+	Namespace   string
+	Name        string
+	APIGroup    string `json:"apiGroup"`
+	APIVersion  string `json:"apiVersion"`
+	Subresource string
+}
+
+// operations maps the verbs which change objects to the operations of
+// admission requests
+var operations = map[string]string{
+	"create":           "CREATE",
+	"update":           "UPDATE",
+	"patch":            "UPDATE",
+	"delete":           "DELETE",
+	"deletecollection": "DELETE",
+}
+
+// objectKey identifies an object without the version, as an object is served
+// in every version of its group
+func objectKey(group, resource, namespace, name string) string {
+	return fmt.Sprintf("%s %s %s %s", group, resource, namespace, name)
+}
+
+// Correlator attaches the audit events of the objects of differences to them
+type Correlator struct {
+	diffs    []report.DiffReport
+	from, to time.Time
+	objects  map[string][]int // indexes of the differences by objectKey()
+	events   map[int][]report.Change
+}
+
+// NewCorrelator creates a Correlator for the differences of resource objects
+// in diffs, only events between from and to, if not zero, are considered
+func NewCorrelator(diffs []report.DiffReport, from, to time.Time) *Correlator {
+	c := &Correlator{
+		diffs:   diffs,
+		from:    from,
+		to:      to,
+		objects: map[string][]int{},
+		events:  map[int][]report.Change{},
+	}
+
+	for i, d := range diffs {
+		o := d.ResourceObject
+		if o == nil {
+			continue
+		}
+
+		group, _ := report.SplitGroupVersionSafe(o.GroupVersion)
+		key := objectKey(group, o.Resource, o.Namespace, o.Name)
+		c.objects[key] = append(c.objects[key], i)
+	}
+
+	return c
+}
+
+// Read reads an audit log in JSON lines format and collects the events of the
+// objects. Lines which are no audit events are skipped.
+func (c *Correlator) Read(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 {
+			e := Event{}
+			if json.Unmarshal(line, &e) == nil {
+				c.add(e)
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadFile reads the audit log file
+func (c *Correlator) ReadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := c.Read(f); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+
+	return nil
+}
+
+// add collects e if it is a successful change of one of the objects
+func (c *Correlator) add(e Event) {
+	operation, ok := operations[e.Verb]
+	switch {
+	case !ok, e.Stage != "ResponseComplete", e.ObjectRef == nil, e.ObjectRef.Subresource != "":
+		return
+	case e.ResponseStatus == nil || e.ResponseStatus.Code < 200 || e.ResponseStatus.Code >= 300:
+		return
+	case e.StageTimestamp.Before(c.from) || (!c.to.IsZero() && e.StageTimestamp.After(c.to)):
+		return
+	}
+
+	ref := e.ObjectRef
+	name := ref.Name
+	if name == "" && e.ResponseObject != nil {
+		// The name is generated for creates with generateName
+		name = e.ResponseObject.Metadata.Name
+	}
+
+	change := report.Change{
+		Time:      e.StageTimestamp,
+		User:      e.User.Username,
+		Groups:    e.User.Groups,
+		Operation: operation,
+		Verb:      e.Verb,
+		UserAgent: e.UserAgent,
+		SourceIPs: e.SourceIPs,
+	}
+
+	indexes := append([]int{}, c.objects[objectKey(ref.APIGroup, ref.Resource, ref.Namespace, name)]...)
+	if e.Verb == "deletecollection" && name == "" {
+		// The objects of a collection are not listed, it is attributed to all
+		// removed objects of the resource in the namespace
+		prefix := objectKey(ref.APIGroup, ref.Resource, ref.Namespace, "")
+		for key, i := range c.objects {
+			if strings.HasPrefix(key, prefix) {
+				indexes = append(indexes, i...)
+			}
+		}
+	}
+
+	for _, i := range indexes {
+		if e.Verb == "deletecollection" && c.diffs[i].Kind != report.ChangeRemoved {
+			continue
+		}
+		c.events[i] = append(c.events[i], change)
+
+		// Objects which change all the time would keep all their events
+		if len(c.events[i]) > 2*MaxEvents {
+			c.events[i] = latest(c.events[i])
+		}
+	}
+}
+
+// latest returns the latest MaxEvents of events sorted by their time
+func latest(events []report.Change) []report.Change {
+	sort.SliceStable(events, func(a, b int) bool {
+		return events[a].Time.Before(events[b].Time)
+	})
+
+	if len(events) > MaxEvents {
+		return append([]report.Change{}, events[len(events)-MaxEvents:]...)
+	}
+
+	return events
+}
+
+// Attach sets the AuditEvents of the differences to the latest MaxEvents
+// collected events of their object
+func (c *Correlator) Attach() {
+	for i, events := range c.events {
+		c.diffs[i].AuditEvents = latest(events)
+	}
+}
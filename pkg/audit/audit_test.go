@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+func object(groupVersion, resource, namespace, name string) *report.ResourceObject {
+	return &report.ResourceObject{GroupVersion: groupVersion, Resource: resource, Namespace: namespace, Name: name}
+}
+
+func TestCorrelate(t *testing.T) {
+	diffs := []report.DiffReport{
+		{Element: "ScanStart", Kind: report.ChangeMetadata},
+		{Kind: report.ChangeAdded, ResourceObject: object("v1", "namespaces", "", "appl-shouldnotbehere")},
+		// Served in another version of the group than the patch
+		{Kind: report.ChangeModified, ResourceObject: object("apps/v1beta2", "deployments", "kube-system", "coredns")},
+		{Kind: report.ChangeAdded, ResourceObject: object("v1", "configmaps", "default", "settings-x7k2p")},
+		{Kind: report.ChangeRemoved, ResourceObject: object("v1", "secrets", "default", "token")},
+		{Kind: report.ChangeRemoved, ResourceObject: object("v1", "secrets", "kube-system", "token")},
+	}
+
+	from := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	c := NewCorrelator(diffs, from, from.Add(time.Hour))
+	if err := c.ReadFile("testdata/audit.log"); err != nil {
+		t.Fatal(err)
+	}
+	c.Attach()
+
+	exp := []string{
+		"",
+		"created by alice from 10.0.0.7 with kubectl/v1.12.3 (linux/amd64) kubernetes/435f92c at 2018-06-12T12:10:00Z",
+		"patched by bob from 10.0.0.8 with helm/v2.11.0 at 2018-06-12T12:20:00Z",
+		"created by erin at 2018-06-12T12:30:00Z",
+		"deleted with collection by frank at 2018-06-12T12:40:00Z",
+		"",
+	}
+
+	for i, d := range diffs {
+		got := []string{}
+		for _, e := range d.AuditEvents {
+			got = append(got, e.String())
+		}
+
+		if strings.Join(got, "; ") != exp[i] {
+			t.Errorf("Got events %v for difference %d, expected %s", got, i, exp[i])
+		}
+	}
+
+	if e := diffs[1].AuditEvents[0]; e.Operation != "CREATE" || e.Groups[0] != "system:authenticated" {
+		t.Errorf("Got %+v", e)
+	}
+}
+
+func TestCorrelateMaxEvents(t *testing.T) {
+	diffs := []report.DiffReport{{Kind: report.ChangeModified, ResourceObject: object("v1", "configmaps", "default", "a")}}
+	from := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+
+	log := ""
+	for i := MaxEvents + 5; i > 0; i-- {
+		log += fmt.Sprintf(`{"stage":"ResponseComplete","verb":"update","user":{"username":"user%d"},"objectRef":{"resource":"configmaps","namespace":"default","name":"a","apiVersion":"v1"},"responseStatus":{"code":200},"stageTimestamp":"%s"}`+"\n",
+			i, from.Add(time.Duration(i)*time.Minute).Format(time.RFC3339Nano))
+	}
+
+	c := NewCorrelator(diffs, from, from.Add(time.Hour))
+	if err := c.Read(strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	c.Attach()
+
+	events := diffs[0].AuditEvents
+	if len(events) != MaxEvents || events[0].User != "user6" || events[MaxEvents-1].User != fmt.Sprintf("user%d", MaxEvents+5) {
+		t.Errorf("Got %d events from %s to %s", len(events), events[0].User, events[len(events)-1].User)
+	}
+}
@@ -0,0 +1,361 @@
+package crd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	yaml "gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// The KubewireBaseline and KubewireBaselineChunk CustomResourceDefinitions,
+// see deployment/crd.yaml
+const (
+	Group         = "kubewire.postfinance.ch"
+	Version       = "v1alpha1"
+	Kind          = "KubewireBaseline"
+	Resource      = "kubewirebaselines"
+	ChunkKind     = "KubewireBaselineChunk"
+	ChunkResource = "kubewirebaselinechunks"
+)
+
+// GroupVersionResource of the KubewireBaseline objects
+var GroupVersionResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: Resource}
+
+// ChunkGroupVersionResource of the KubewireBaselineChunk objects
+var ChunkGroupVersionResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: ChunkResource}
+
+// RefPrefix selects a KubewireBaseline instead of a file e.g.
+// kubewirebaseline/production
+const RefPrefix = "kubewirebaseline/"
+
+// BaselineLabel labels the chunks with the name of their KubewireBaseline
+const BaselineLabel = Group + "/baseline"
+
+// Encoding of the baseline in the data of the chunks
+const Encoding = "gzip+base64"
+
+const (
+	// ChunkSize is the length of the encoded baseline in one chunk, it
+	// leaves enough room to the object size limit of etcd
+	ChunkSize = 768 * 1024
+	// MaxChunks limits the encoded baseline to 48 MiB
+	MaxChunks = 64
+	// MaxStatusDifferences limits the differences listed in the status
+	MaxStatusDifferences = 100
+)
+
+// Status of a KubewireBaseline, it holds the result of the last comparison of
+// the live cluster with the baseline
+type Status struct {
+	LastScan time.Time      `json:"lastScan"`
+	Server   string         `json:"server,omitempty"`
+	Drift    bool           `json:"drift"`
+	Changes  map[string]int `json:"changes,omitempty"`
+	// Differences lists the change type and element of the first
+	// MaxStatusDifferences differences other than metadata
+	Differences []string `json:"differences,omitempty"`
+}
+
+// NewStatus creates the status for the result of a comparison with the live
+// report, the drift is decided by the change types of failOn
+func NewStatus(live report.Report, result report.DiffResult, failOn []string) Status {
+	s := Status{
+		LastScan:    live.ScanEnd,
+		Server:      live.Server.Host,
+		Drift:       result.Drift(failOn),
+		Changes:     result.Changes,
+		Differences: []string{},
+	}
+
+	for _, d := range result.Differences {
+		if d.Kind == report.ChangeMetadata {
+			continue
+		}
+		if len(s.Differences) == MaxStatusDifferences {
+			break
+		}
+		s.Differences = append(s.Differences, d.Kind+" "+d.Element)
+	}
+
+	return s
+}
+
+// IsRef returns true if s references a KubewireBaseline
+func IsRef(s string) bool {
+	return strings.HasPrefix(s, RefPrefix) && len(s) > len(RefPrefix)
+}
+
+// RefName returns the name of the KubewireBaseline referenced by s
+func RefName(s string) string {
+	return strings.TrimPrefix(s, RefPrefix)
+}
+
+// Encode returns the spec of the KubewireBaseline name holding rep and the
+// KubewireBaselineChunks with the encoded baseline, which the spec references
+// in order. Every chunk is a separate object, as a single object can not
+// exceed the size limit of etcd. The names of the chunks contain the checksum
+// of the baseline, so that an update never overwrites the chunks of the
+// previous baseline.
+func Encode(name string, rep report.Report) (map[string]interface{}, []*unstructured.Unstructured, error) {
+	raw, err := yaml.Marshal(rep)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+	if n := (len(data) + ChunkSize - 1) / ChunkSize; n > MaxChunks {
+		return nil, nil, fmt.Errorf("encoded baseline of %d bytes exceeds the maximum of %d chunks of %d bytes", len(data), MaxChunks, ChunkSize)
+	}
+
+	sum := sha256.Sum256(raw)
+	checksum := hex.EncodeToString(sum[:])
+
+	names := []interface{}{}
+	chunks := []*unstructured.Unstructured{}
+	for i := 0; len(data) > 0; i++ {
+		part := data
+		if len(part) > ChunkSize {
+			part = data[:ChunkSize]
+		}
+		data = data[len(part):]
+
+		chunk := &unstructured.Unstructured{}
+		chunk.SetAPIVersion(Group + "/" + Version)
+		chunk.SetKind(ChunkKind)
+		chunk.SetName(fmt.Sprintf("%s-%s-%d", name, checksum[:10], i))
+		chunk.SetLabels(map[string]string{BaselineLabel: name})
+		chunk.Object["spec"] = map[string]interface{}{
+			"baseline": name,
+			"index":    int64(i),
+			"data":     part,
+		}
+
+		names = append(names, chunk.GetName())
+		chunks = append(chunks, chunk)
+	}
+
+	return map[string]interface{}{
+		"server":          rep.Server.Host,
+		"scanStart":       rep.ScanStart.UTC().Format(time.RFC3339),
+		"resourceObjects": int64(len(rep.ResourceObjects)),
+		"encoding":        Encoding,
+		"sha256":          checksum,
+		"chunks":          names,
+	}, chunks, nil
+}
+
+// Decode returns the baseline of the KubewireBaseline obj from its chunks in
+// the order of the spec
+func Decode(obj *unstructured.Unstructured, chunks []*unstructured.Unstructured) (*report.Report, error) {
+	encoding, _, _ := unstructured.NestedString(obj.Object, "spec", "encoding")
+	if encoding != Encoding {
+		return nil, fmt.Errorf("%s %s: unknown encoding %q", Kind, obj.GetName(), encoding)
+	}
+
+	names, _, err := unstructured.NestedStringSlice(obj.Object, "spec", "chunks")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", Kind, obj.GetName(), err)
+	}
+	if len(names) != len(chunks) {
+		return nil, fmt.Errorf("%s %s: got %d chunks, expected %d", Kind, obj.GetName(), len(chunks), len(names))
+	}
+
+	data := []string{}
+	for i, chunk := range chunks {
+		if chunk.GetName() != names[i] {
+			return nil, fmt.Errorf("%s %s: got chunk %s, expected %s", Kind, obj.GetName(), chunk.GetName(), names[i])
+		}
+
+		part, _, err := unstructured.NestedString(chunk.Object, "spec", "data")
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %s", ChunkKind, chunk.GetName(), err)
+		}
+		data = append(data, part)
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(strings.Join(data, ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", Kind, obj.GetName(), err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", Kind, obj.GetName(), err)
+	}
+
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", Kind, obj.GetName(), err)
+	}
+
+	sum := sha256.Sum256(raw)
+	if expected, _, _ := unstructured.NestedString(obj.Object, "spec", "sha256"); expected != hex.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("%s %s: checksum mismatch", Kind, obj.GetName())
+	}
+
+	rep := &report.Report{}
+	if err := yaml.Unmarshal(raw, rep); err != nil {
+		return nil, fmt.Errorf("%s %s: %s", Kind, obj.GetName(), err)
+	}
+
+	return rep, nil
+}
+
+// Client stores and loads baselines as KubewireBaseline objects
+type Client struct {
+	resources dynamic.ResourceInterface
+	chunks    dynamic.ResourceInterface
+}
+
+// New creates a Client for the cluster of config
+func New(config *rest.Config) (*Client, error) {
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		resources: dyn.Resource(GroupVersionResource),
+		chunks:    dyn.Resource(ChunkGroupVersionResource),
+	}, nil
+}
+
+// Push stores rep as the KubewireBaseline name, it is created if it does not
+// exist yet. The status of an existing one is kept. The chunks are owned by
+// the KubewireBaseline, so they are garbage collected with it. On updates they
+// are written before the KubewireBaseline references them and the chunks of
+// the previous baseline are deleted afterwards.
+func (c *Client) Push(name string, rep report.Report) error {
+	spec, chunks, err := Encode(name, rep)
+	if err != nil {
+		return err
+	}
+
+	var previous []string
+	obj, err := c.resources.Get(name, meta_v1.GetOptions{})
+	exists := err == nil
+	switch {
+	case apierrors.IsNotFound(err):
+		// The owner of the chunks must exist first
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion(Group + "/" + Version)
+		obj.SetKind(Kind)
+		obj.SetName(name)
+		obj.Object["spec"] = spec
+
+		if obj, err = c.resources.Create(obj, meta_v1.CreateOptions{}); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		previous, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "chunks")
+	}
+
+	owner := meta_v1.OwnerReference{APIVersion: Group + "/" + Version, Kind: Kind, Name: name, UID: obj.GetUID()}
+	current := map[string]bool{}
+	for _, chunk := range chunks {
+		current[chunk.GetName()] = true
+		chunk.SetOwnerReferences([]meta_v1.OwnerReference{owner})
+
+		// Existing chunks hold the same data, as the names contain the
+		// checksum
+		_, err := c.chunks.Create(chunk, meta_v1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	if !exists {
+		return nil
+	}
+
+	obj.Object["spec"] = spec
+	if _, err := c.resources.Update(obj, meta_v1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	for _, n := range previous {
+		if current[n] {
+			continue
+		}
+
+		err := c.chunks.Delete(n, &meta_v1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Pull loads the baseline of the KubewireBaseline name
+func (c *Client) Pull(name string) (*report.Report, error) {
+	obj, err := c.resources.Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names, _, err := unstructured.NestedStringSlice(obj.Object, "spec", "chunks")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", Kind, name, err)
+	}
+
+	chunks := []*unstructured.Unstructured{}
+	for _, n := range names {
+		chunk, err := c.chunks.Get(n, meta_v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return Decode(obj, chunks)
+}
+
+// SetStatus updates the status of the KubewireBaseline name
+func (c *Client) SetStatus(name string, status Status) error {
+	raw, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	s := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return err
+	}
+
+	obj, err := c.resources.Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	obj.Object["status"] = s
+	_, err = c.resources.UpdateStatus(obj, meta_v1.UpdateOptions{})
+
+	return err
+}
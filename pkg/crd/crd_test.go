@@ -0,0 +1,190 @@
+package crd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// fakeResources keeps the objects in memory, the other methods are not
+// implemented
+type fakeResources struct {
+	dynamic.ResourceInterface
+	objects map[string]*unstructured.Unstructured
+}
+
+func (f *fakeResources) Get(name string, options meta_v1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	obj, ok := f.objects[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(GroupVersionResource.GroupResource(), name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (f *fakeResources) Create(obj *unstructured.Unstructured, options meta_v1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if _, ok := f.objects[obj.GetName()]; ok {
+		return nil, apierrors.NewAlreadyExists(GroupVersionResource.GroupResource(), obj.GetName())
+	}
+	f.objects[obj.GetName()] = obj.DeepCopy()
+	return obj, nil
+}
+
+func (f *fakeResources) Update(obj *unstructured.Unstructured, options meta_v1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	// Like the API server, the status is not updated without subresource
+	old := f.objects[obj.GetName()]
+	obj = obj.DeepCopy()
+	obj.Object["status"] = old.Object["status"]
+	f.objects[obj.GetName()] = obj
+	return obj, nil
+}
+
+func (f *fakeResources) Delete(name string, options *meta_v1.DeleteOptions, subresources ...string) error {
+	if _, ok := f.objects[name]; !ok {
+		return apierrors.NewNotFound(ChunkGroupVersionResource.GroupResource(), name)
+	}
+	delete(f.objects, name)
+	return nil
+}
+
+func (f *fakeResources) UpdateStatus(obj *unstructured.Unstructured, options meta_v1.UpdateOptions) (*unstructured.Unstructured, error) {
+	old := f.objects[obj.GetName()].DeepCopy()
+	old.Object["status"] = obj.Object["status"]
+	f.objects[obj.GetName()] = old
+	return old, nil
+}
+
+func baseline(objects int) report.Report {
+	rep := report.Report{
+		Server:    report.Server{Host: "https://cluster"},
+		ScanStart: time.Date(2018, 6, 12, 12, 19, 14, 0, time.UTC),
+	}
+
+	for i := 0; i < objects; i++ {
+		// Hardly compressible
+		sum := sha256.Sum256([]byte(time.Duration(i).String()))
+		rep.ResourceObjects = append(rep.ResourceObjects, report.ResourceObject{
+			GroupVersion: "v1",
+			Resource:     "configmaps",
+			Namespace:    "kube-system",
+			Name:         strings.Repeat("x", i%50) + time.Duration(i).String(),
+			Hash:         "sha256:" + hex.EncodeToString(sum[:]),
+		})
+	}
+
+	return rep
+}
+
+func TestPushPull(t *testing.T) {
+	f := &fakeResources{objects: map[string]*unstructured.Unstructured{}}
+	chunks := &fakeResources{objects: map[string]*unstructured.Unstructured{}}
+	c := &Client{resources: f, chunks: chunks}
+
+	// Big enough for multiple chunks
+	rep := baseline(40000)
+	if err := c.Push("production", rep); err != nil {
+		t.Fatal(err)
+	}
+
+	names, _, _ := unstructured.NestedStringSlice(f.objects["production"].Object, "spec", "chunks")
+	if len(names) < 2 || len(chunks.objects) != len(names) {
+		t.Fatalf("Got %d chunks referencing %d objects, expected multiple", len(chunks.objects), len(names))
+	}
+	for _, n := range names {
+		chunk := chunks.objects[n]
+		if chunk == nil {
+			t.Fatalf("Chunk %s does not exist", n)
+		}
+		if owners := chunk.GetOwnerReferences(); len(owners) != 1 || owners[0].Kind != Kind || owners[0].Name != "production" {
+			t.Errorf("Got owners %v of chunk %s", owners, n)
+		}
+		if chunk.GetLabels()[BaselineLabel] != "production" {
+			t.Errorf("Got labels %v of chunk %s", chunk.GetLabels(), n)
+		}
+	}
+
+	got, err := c.Pull("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ResourceObjects) != len(rep.ResourceObjects) || got.ResourceObjects[39999].Key() != rep.ResourceObjects[39999].Key() || !got.ScanStart.Equal(rep.ScanStart) {
+		t.Errorf("Pulled baseline differs from the pushed one")
+	}
+
+	// Status
+	result := report.DiffResult{
+		Differences: []report.DiffReport{
+			{Element: "ScanStart", Kind: report.ChangeMetadata},
+			{Element: "ResourceObject v1 namespaces//appl", Kind: report.ChangeAdded},
+		},
+		Changes: map[string]int{report.ChangeAdded: 1, report.ChangeMetadata: 1},
+	}
+	if err := c.SetStatus("production", NewStatus(rep, result, report.DefaultFailOn)); err != nil {
+		t.Fatal(err)
+	}
+
+	drift, _, _ := unstructured.NestedBool(f.objects["production"].Object, "status", "drift")
+	diffs, _, _ := unstructured.NestedStringSlice(f.objects["production"].Object, "status", "differences")
+	if !drift || len(diffs) != 1 || diffs[0] != "added ResourceObject v1 namespaces//appl" {
+		t.Errorf("Got status %v", f.objects["production"].Object["status"])
+	}
+
+	// Pushing again keeps the status
+	if err := c.Push("production", baseline(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.objects["production"].Object["status"]; !ok {
+		t.Error("Expected the status to be kept")
+	}
+	if got, err := c.Pull("production"); err != nil || len(got.ResourceObjects) != 1 {
+		t.Errorf("Got %v, %v after the update", got, err)
+	}
+	if len(chunks.objects) != 1 {
+		t.Errorf("Got %d chunks after the update, expected the previous ones to be deleted", len(chunks.objects))
+	}
+
+	// Pushing the same baseline keeps its chunks
+	if err := c.Push("production", baseline(1)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Pull("production"); err != nil || len(got.ResourceObjects) != 1 || len(chunks.objects) != 1 {
+		t.Errorf("Got %v, %v and %d chunks after pushing the same baseline", got, err, len(chunks.objects))
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	spec, chunks, err := Encode("production", baseline(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	if _, err := Decode(obj, nil); err == nil || !strings.Contains(err.Error(), "expected 1") {
+		t.Errorf("Got %v, expected missing chunks", err)
+	}
+
+	spec["sha256"] = "0"
+	if _, err := Decode(obj, chunks); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Got %v, expected a checksum mismatch", err)
+	}
+
+	spec["encoding"] = "plain"
+	if _, err := Decode(obj, chunks); err == nil {
+		t.Error("Expected an error for an unknown encoding")
+	}
+}
+
+func TestIsRef(t *testing.T) {
+	for s, exp := range map[string]bool{"kubewirebaseline/production": true, "kubewirebaseline/": false, "baseline.yaml": false, "@baseline": false} {
+		if IsRef(s) != exp {
+			t.Errorf("IsRef(%s) = %v, expected %v", s, !exp, exp)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	typed_core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/reference"
+)
+
+// ClientRecorder is an EventRecorder which creates the events synchronously,
+// so that none get lost if kubewire exits right after a diff. Failures are
+// collected and returned by Err.
+type ClientRecorder struct {
+	client typed_core_v1.EventsGetter
+	source core_v1.EventSource
+
+	mu   sync.Mutex
+	errs []string
+}
+
+// NewClientRecorder creates a ClientRecorder with the source host
+func NewClientRecorder(client typed_core_v1.EventsGetter, host string) *ClientRecorder {
+	return &ClientRecorder{
+		client: client,
+		source: core_v1.EventSource{Component: Component, Host: host},
+	}
+}
+
+// Event creates an event about object
+func (c *ClientRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	ref, err := reference.GetReference(scheme.Scheme, object)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = meta_v1.NamespaceDefault
+	}
+
+	now := meta_v1.Time{Time: time.Now()}
+	event := &core_v1.Event{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		Source:         c.source,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventtype,
+	}
+
+	if _, err := c.client.Events(namespace).Create(event); err != nil {
+		c.fail(fmt.Errorf("event %s on %s %s/%s: %s", reason, ref.Kind, ref.Namespace, ref.Name, err))
+	}
+}
+
+// Err returns the failures since the last call combined
+func (c *ClientRecorder) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.errs) == 0 {
+		return nil
+	}
+
+	err := errors.New(strings.Join(c.errs, "; "))
+	c.errs = nil
+
+	return err
+}
+
+func (c *ClientRecorder) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errs = append(c.errs, err.Error())
+}
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Reasons of the events
+const (
+	// ReasonUnexpectedObject is recorded on objects which do not exist in the
+	// baseline
+	ReasonUnexpectedObject = "KubewireUnexpectedObject"
+	// ReasonModifiedObject is recorded on objects which differ from the
+	// baseline
+	ReasonModifiedObject = "KubewireModifiedObject"
+	// ReasonMissingObjects is recorded on the target for the objects of the
+	// baseline which do not exist anymore
+	ReasonMissingObjects = "KubewireMissingObjects"
+)
+
+// Component is the source of the events
+const Component = "kubewire"
+
+// maxMessage is the length of the messages, the API server rejects events
+// with longer messages
+const maxMessage = 1024
+
+// EventRecorder records an event about object, it is implemented by the
+// EventRecorder of k8s.io/client-go/tools/record as well
+type EventRecorder interface {
+	Event(object runtime.Object, eventtype, reason, message string)
+}
+
+// Recorder records the drift of resource objects as Kubernetes events
+type Recorder struct {
+	recorder EventRecorder
+	kinds    map[string]string // by GroupVersion and resource name
+	target   *core_v1.ObjectReference
+}
+
+// New creates a Recorder. The kinds of the objects are looked up in
+// resources, the summary of the removed objects is recorded on target
+func New(recorder EventRecorder, resources []report.Resource, target *core_v1.ObjectReference) *Recorder {
+	r := &Recorder{
+		recorder: recorder,
+		kinds:    map[string]string{},
+		target:   target,
+	}
+
+	for _, res := range resources {
+		r.kinds[res.GroupVersion+" "+res.Name] = res.Kind
+	}
+
+	return r
+}
+
+// Target returns the Pod kubewire runs in according to the environment
+// variables POD_NAME and POD_NAMESPACE, e.g. set by the downward API. Outside
+// of a Pod it returns the namespace of POD_NAMESPACE or default.
+func Target() *core_v1.ObjectReference {
+	name, namespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	if name == "" {
+		return &core_v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: namespace, Namespace: namespace}
+	}
+
+	return &core_v1.ObjectReference{APIVersion: "v1", Kind: "Pod", Name: name, Namespace: namespace}
+}
+
+// Record records a warning event on every added or modified, including
+// recreated, resource object of diffs and one on the target which lists the removed ones
+func (r *Recorder) Record(diffs []report.DiffReport) {
+	added, modified, removed := []report.ResourceObject{}, []report.ResourceObject{}, []string{}
+	changes := map[string][]string{} // of the modified objects by Key()
+	seen := map[string]bool{}
+
+	for _, d := range diffs {
+		o := d.ResourceObject
+		if o == nil {
+			continue
+		}
+
+		key := o.Key()
+		kind := d.Kind
+		switch {
+		case kind == report.ChangeModified && d.Path != "":
+			changes[key] = append(changes[key], d.Path)
+		case kind == report.ChangeRecreated:
+			changes[key] = append(changes[key], "recreated "+d.B)
+			kind = report.ChangeModified
+		case kind == report.ChangeNewManager:
+			changes[key] = append(changes[key], "new field manager "+d.B)
+			kind = report.ChangeModified
+		}
+
+		if seen[kind+" "+key] {
+			continue
+		}
+		seen[kind+" "+key] = true
+
+		switch kind {
+		case report.ChangeAdded:
+			added = append(added, *o)
+		case report.ChangeModified:
+			modified = append(modified, *o)
+		case report.ChangeRemoved:
+			removed = append(removed, o.String())
+		}
+	}
+
+	for _, o := range added {
+		r.recorder.Event(r.Reference(o), core_v1.EventTypeWarning, ReasonUnexpectedObject, "Object does not exist in the baseline")
+	}
+
+	for _, o := range modified {
+		msg := "Object differs from the baseline"
+		if paths := changes[o.Key()]; len(paths) != 0 {
+			msg += ": " + strings.Join(paths, ", ")
+		}
+		r.recorder.Event(r.Reference(o), core_v1.EventTypeWarning, ReasonModifiedObject, truncate(msg))
+	}
+
+	if len(removed) != 0 && r.target != nil {
+		sort.Strings(removed)
+		msg := fmt.Sprintf("%d objects of the baseline do not exist: %s", len(removed), strings.Join(removed, ", "))
+		r.recorder.Event(r.target, core_v1.EventTypeWarning, ReasonMissingObjects, truncate(msg))
+	}
+}
+
+// Reference returns the reference of the event on o
+func (r *Recorder) Reference(o report.ResourceObject) *core_v1.ObjectReference {
+	return &core_v1.ObjectReference{
+		APIVersion: o.GroupVersion,
+		Kind:       r.kinds[o.GroupVersion+" "+o.Resource],
+		Namespace:  o.Namespace,
+		Name:       o.Name,
+	}
+}
+
+// truncate shortens msg to the maximum length of event messages
+func truncate(msg string) string {
+	if len(msg) <= maxMessage {
+		return msg
+	}
+
+	return msg[:maxMessage-3] + "..."
+}
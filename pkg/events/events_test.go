@@ -0,0 +1,112 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	typed_core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeRecorder records the events as strings
+type fakeRecorder struct {
+	events []string
+}
+
+func (f *fakeRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	ref := object.(*core_v1.ObjectReference)
+	f.events = append(f.events, fmt.Sprintf("%s %s %s %s %s/%s: %s", eventtype, reason, ref.APIVersion, ref.Kind, ref.Namespace, ref.Name, message))
+}
+
+func TestRecord(t *testing.T) {
+	resources := []report.Resource{
+		{GroupVersion: "v1", Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+		{GroupVersion: "v1", Name: "namespaces", Kind: "Namespace"},
+	}
+
+	cm := &report.ResourceObject{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "coredns"}
+	diffs := []report.DiffReport{
+		{Element: "ScanStart", Kind: report.ChangeMetadata},
+		{Element: "ResourceObject v1 namespaces//appl", Kind: report.ChangeAdded, ResourceObject: &report.ResourceObject{GroupVersion: "v1", Resource: "namespaces", Name: "appl"}},
+		{Element: cm.String(), Path: "data.Corefile", Kind: report.ChangeModified, ResourceObject: cm},
+		{Element: cm.String(), Path: "metadata.labels.app", Kind: report.ChangeModified, ResourceObject: cm},
+		{Element: cm.String() + ".Metadata.Managers.kubectl-edit", A: "does not exist", B: "kubectl-edit", Kind: report.ChangeNewManager, ResourceObject: cm},
+		{Element: "ResourceObject v1 namespaces//b", Kind: report.ChangeRemoved, ResourceObject: &report.ResourceObject{GroupVersion: "v1", Resource: "namespaces", Name: "b"}},
+		{Element: "ResourceObject v1 namespaces//a", Kind: report.ChangeRemoved, ResourceObject: &report.ResourceObject{GroupVersion: "v1", Resource: "namespaces", Name: "a"}},
+	}
+
+	f := &fakeRecorder{}
+	New(f, resources, &core_v1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "kube-system", Name: "kubewire-1"}).Record(diffs)
+
+	exp := []string{
+		"Warning KubewireUnexpectedObject v1 Namespace /appl: Object does not exist in the baseline",
+		"Warning KubewireModifiedObject v1 ConfigMap kube-system/coredns: Object differs from the baseline: data.Corefile, metadata.labels.app, new field manager kubectl-edit",
+		"Warning KubewireMissingObjects v1 Pod kube-system/kubewire-1: 2 objects of the baseline do not exist: v1 namespaces//a, v1 namespaces//b",
+	}
+
+	if strings.Join(f.events, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Got events\n%s\nexpected\n%s", strings.Join(f.events, "\n"), strings.Join(exp, "\n"))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate(strings.Repeat("x", 2000)); len(got) != maxMessage || !strings.HasSuffix(got, "...") {
+		t.Errorf("Got message of length %d", len(got))
+	}
+}
+
+// fakeEvents records the created events, the other methods are not implemented
+type fakeEvents struct {
+	typed_core_v1.EventInterface
+	created *[]*core_v1.Event
+	err     error
+}
+
+func (f fakeEvents) Create(event *core_v1.Event) (*core_v1.Event, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	*f.created = append(*f.created, event)
+	return event, nil
+}
+
+type fakeClient struct {
+	created []*core_v1.Event
+	err     error
+}
+
+func (f *fakeClient) Events(namespace string) typed_core_v1.EventInterface {
+	return fakeEvents{created: &f.created, err: f.err}
+}
+
+func TestClientRecorder(t *testing.T) {
+	client := &fakeClient{}
+	c := NewClientRecorder(client, "ci-runner")
+
+	c.Event(&core_v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: "appl"}, core_v1.EventTypeWarning, ReasonUnexpectedObject, "msg")
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.created) != 1 {
+		t.Fatalf("Got %d events, expected 1", len(client.created))
+	}
+
+	e := client.created[0]
+	if e.Namespace != "default" || e.InvolvedObject.Name != "appl" || e.Source.Component != Component || e.Source.Host != "ci-runner" || e.Reason != ReasonUnexpectedObject {
+		t.Errorf("Got event %+v", e)
+	}
+
+	client.err = errors.New("forbidden")
+	c.Event(&core_v1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: "appl"}, core_v1.EventTypeWarning, ReasonUnexpectedObject, "msg")
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("Got error %v, expected forbidden", err)
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Expected the errors to be reset, got %v", err)
+	}
+}
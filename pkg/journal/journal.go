@@ -0,0 +1,194 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+// Entry records a create, update or delete of an object
+type Entry struct {
+	Time         time.Time
+	User         string
+	Groups       []string `yaml:",omitempty" json:",omitempty"`
+	Operation    string   // CREATE|UPDATE|DELETE
+	GroupVersion string
+	Resource     string
+	Namespace    string `yaml:",omitempty" json:",omitempty"`
+	Name         string
+	// UID identifies the admission request
+	UID string `yaml:",omitempty" json:",omitempty"`
+}
+
+// objectKey identifies the object of a resource without the version, as an
+// object can be changed through every version of its group
+func objectKey(groupVersion, resource, namespace, name string) string {
+	group, _ := report.SplitGroupVersionSafe(groupVersion)
+	return fmt.Sprintf("%s %s %s %s", group, resource, namespace, name)
+}
+
+// Journal appends entries to a file, one JSON document per line. If the file
+// would exceed its maximum size, it is rotated to the file with the suffix .1,
+// which replaces the previously rotated one.
+type Journal struct {
+	mu      sync.Mutex
+	name    string
+	file    *os.File
+	size    int64
+	maxSize int64
+}
+
+// Open opens the journal file for appending, it is created if it does not
+// exist. maxSize is the size in bytes to rotate the file at, 0 to never rotate
+// it.
+func Open(file string, maxSize int64) (*Journal, error) {
+	j := &Journal{name: file, maxSize: maxSize}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	f, err := os.OpenFile(j.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	j.file, j.size = f, info.Size()
+
+	return nil
+}
+
+// rotate renames the journal file to the rotated one and opens a new file
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(j.name, Rotated(j.name)); err != nil {
+		return err
+	}
+
+	return j.open()
+}
+
+// Append writes e to the journal
+func (j *Journal) Append(e Entry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	raw = append(raw, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.maxSize > 0 && j.size > 0 && j.size+int64(len(raw)) > j.maxSize {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := j.file.Write(raw)
+	j.size += int64(n)
+
+	return err
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Rotated returns the name of the rotated journal file
+func Rotated(file string) string {
+	return file + ".1"
+}
+
+// Read reads all entries of the rotated journal file, if it exists, and of
+// the journal file
+func Read(file string) ([]Entry, error) {
+	entries, err := readFile(Rotated(file))
+	if os.IsNotExist(err) {
+		entries, err = []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(entries, current...), nil
+}
+
+func readFile(file string) ([]Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		e := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", file, line, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Annotate sets the LastChange of the differences of resource objects to the
+// latest entry of their object
+func Annotate(diffs []report.DiffReport, entries []Entry) {
+	latest := map[string]Entry{}
+	for _, e := range entries {
+		key := objectKey(e.GroupVersion, e.Resource, e.Namespace, e.Name)
+		if l, ok := latest[key]; !ok || !e.Time.Before(l.Time) {
+			latest[key] = e
+		}
+	}
+
+	for i, d := range diffs {
+		o := d.ResourceObject
+		if o == nil {
+			continue
+		}
+
+		e, ok := latest[objectKey(o.GroupVersion, o.Resource, o.Namespace, o.Name)]
+		if !ok {
+			continue
+		}
+
+		diffs[i].LastChange = &report.Change{
+			Time:      e.Time,
+			User:      e.User,
+			Groups:    e.Groups,
+			Operation: e.Operation,
+		}
+	}
+}
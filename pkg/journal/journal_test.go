@@ -0,0 +1,144 @@
+package journal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubewire-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "journal.jsonl")
+	t0 := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+
+	j, err := Open(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Entry{
+		{Time: t0, User: "alice", Operation: "CREATE", GroupVersion: "v1", Resource: "namespaces", Name: "appl"},
+		{Time: t0, User: "bob", Operation: "CREATE", GroupVersion: "extensions/v1beta1", Resource: "deployments", Namespace: "kube-system", Name: "dns"},
+		{Time: t0.Add(time.Hour), User: "carol", Groups: []string{"admins"}, Operation: "UPDATE", GroupVersion: "extensions/v1beta1", Resource: "deployments", Namespace: "kube-system", Name: "dns"},
+	} {
+		if err := j.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Groups[0] != "admins" {
+		t.Fatalf("Got entries %+v", entries)
+	}
+
+	diffs := []report.DiffReport{
+		{Element: "ScanStart", Kind: report.ChangeMetadata},
+		{Kind: report.ChangeAdded, ResourceObject: &report.ResourceObject{GroupVersion: "v1", Resource: "namespaces", Name: "appl"}},
+		// Changed through another version of the group
+		{Kind: report.ChangeModified, ResourceObject: &report.ResourceObject{GroupVersion: "extensions/v1beta2", Resource: "deployments", Namespace: "kube-system", Name: "dns"}},
+		{Kind: report.ChangeRemoved, ResourceObject: &report.ResourceObject{GroupVersion: "v1", Resource: "namespaces", Name: "other"}},
+	}
+	Annotate(diffs, entries)
+
+	if diffs[0].LastChange != nil || diffs[3].LastChange != nil {
+		t.Error("Expected differences without journal entry to stay unannotated")
+	}
+	if c := diffs[1].LastChange; c == nil || c.String() != "created by alice at 2018-06-12T12:00:00Z" {
+		t.Errorf("Got %v for the namespace", c)
+	}
+	if c := diffs[2].LastChange; c == nil || c.String() != "updated by carol at 2018-06-12T13:00:00Z" {
+		t.Errorf("Got %v for the deployment", c)
+	}
+}
+
+func TestJournalRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubewire-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "journal.jsonl")
+	t0 := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	entry := func(i int) Entry {
+		return Entry{Time: t0.Add(time.Duration(i) * time.Minute), User: "alice", Operation: "UPDATE", GroupVersion: "v1", Resource: "configmaps", Namespace: "default", Name: "x"}
+	}
+
+	raw, err := json.Marshal(entry(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Room for two entries per file
+	j, err := Open(file, int64(2*(len(raw)+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := j.Append(entry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := readFile(file)
+	if err != nil || len(current) != 1 {
+		t.Fatalf("Got %d entries and %v in the journal, expected the 5th one", len(current), err)
+	}
+
+	entries, err := Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || !entries[0].Time.Equal(entry(2).Time) || !entries[2].Time.Equal(entry(4).Time) {
+		t.Errorf("Got entries %+v, expected the 3rd to 5th one", entries)
+	}
+
+	// Reopening continues with the size of the file
+	j, err = Open(file, int64(2*(len(raw)+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 5; i < 7; i++ {
+		if err := j.Append(entry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	if current, err := readFile(file); err != nil || len(current) != 1 {
+		t.Errorf("Got %d entries and %v after reopening, expected the 7th one", len(current), err)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	f, err := ioutil.TempFile("", "kubewire-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("{\"User\": \"alice\"}\n\n{invalid\n")
+	f.Close()
+
+	if _, err := Read(f.Name()); err == nil {
+		t.Error("Expected an error")
+	}
+}
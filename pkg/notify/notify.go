@@ -0,0 +1,306 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+// SignatureHeader holds the HMAC-SHA256 signature of the body, if a secret is
+// configured for the webhook
+const SignatureHeader = "X-Kubewire-Signature"
+
+// Config defines the webhooks to notify and where to keep the state for the
+// de-duplication
+type Config struct {
+	Webhooks []Webhook
+	// StateFile persists the notified differences across runs e.g. of a
+	// CronJob, empty to keep them in memory only
+	StateFile string `yaml:",omitempty" json:",omitempty"`
+}
+
+// Webhook defines an HTTP endpoint receiving the differences
+type Webhook struct {
+	Name string
+	URL  string
+	// Secret is the key of the HMAC signature of the body, SecretEnv the name of
+	// an environment variable holding it
+	Secret    string            `yaml:",omitempty" json:",omitempty"`
+	SecretEnv string            `yaml:",omitempty" json:",omitempty"`
+	Headers   map[string]string `yaml:",omitempty" json:",omitempty"`
+	// Template is a text/template executed with the Payload to create the
+	// body e.g. for chat systems, empty to post the Payload as JSON
+	Template string `yaml:",omitempty" json:",omitempty"`
+	// Retries defines how often a failed request is retried, the backoff
+	// starts at Backoff and is doubled after every attempt
+	Retries int           `yaml:",omitempty" json:",omitempty"`
+	Backoff time.Duration `yaml:",omitempty" json:",omitempty"`
+	Timeout time.Duration `yaml:",omitempty" json:",omitempty"`
+
+	template *template.Template
+	secret   []byte
+}
+
+// Payload is posted to the webhooks
+type Payload struct {
+	Server      report.Server
+	Context     string `yaml:",omitempty" json:",omitempty"`
+	ScanStart   time.Time
+	ScanEnd     time.Time
+	Differences []report.DiffReport
+	Changes     map[string]int `yaml:",omitempty" json:",omitempty"`
+}
+
+// Defaults of the webhooks
+const (
+	defaultBackoff = time.Second
+	defaultTimeout = 10 * time.Second
+)
+
+// Notifier posts differences to webhooks, the same differences are only sent
+// once until they are resolved
+type Notifier struct {
+	config Config
+	client *http.Client
+
+	mu    sync.Mutex
+	state map[string]string // fingerprint of the last notified differences by stateKey()
+}
+
+// templateFuncs are available in the templates of the webhooks
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+}
+
+// New validates the config and creates a Notifier
+func New(config Config) (*Notifier, error) {
+	names := map[string]bool{}
+	for i := range config.Webhooks {
+		w := &config.Webhooks[i]
+
+		if w.Name == "" || w.URL == "" {
+			return nil, fmt.Errorf("webhook %d: name and url are required", i+1)
+		}
+		if names[w.Name] {
+			return nil, fmt.Errorf("webhook %s: duplicate name", w.Name)
+		}
+		names[w.Name] = true
+
+		if w.Template != "" {
+			t, err := template.New(w.Name).Funcs(templateFuncs).Parse(w.Template)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: %s", w.Name, err)
+			}
+			w.template = t
+		}
+
+		w.secret = []byte(w.Secret)
+		if w.SecretEnv != "" {
+			w.secret = []byte(os.Getenv(w.SecretEnv))
+		}
+
+		if w.Backoff <= 0 {
+			w.Backoff = defaultBackoff
+		}
+		if w.Timeout <= 0 {
+			w.Timeout = defaultTimeout
+		}
+	}
+
+	n := &Notifier{
+		config: config,
+		client: &http.Client{},
+		state:  map[string]string{},
+	}
+
+	if config.StateFile != "" {
+		raw, err := ioutil.ReadFile(config.StateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(raw, &n.state); err != nil {
+				return nil, fmt.Errorf("notification state %s: %s", config.StateFile, err)
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Notify posts p to all webhooks which have not been notified about the same
+// differences yet. Payloads without differences other than metadata reset the
+// state, so that reappearing differences are sent again. The errors of all
+// webhooks are returned combined.
+func (n *Notifier) Notify(p Payload) error {
+	fingerprint := Fingerprint(p.Differences)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	msgs := []string{}
+	for _, w := range n.config.Webhooks {
+		key := stateKey(w, p)
+
+		if fingerprint == "" {
+			delete(n.state, key)
+			continue
+		}
+
+		if n.state[key] == fingerprint {
+			continue
+		}
+
+		if err := n.send(w, p); err != nil {
+			msgs = append(msgs, fmt.Sprintf("webhook %s: %s", w.Name, err))
+			continue
+		}
+
+		n.state[key] = fingerprint
+	}
+
+	if err := n.save(); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+// stateKey returns the key of the state of the webhook w for the cluster of p,
+// so that the clusters of multiple contexts do not share their state
+func stateKey(w Webhook, p Payload) string {
+	if p.Context == "" {
+		return w.Name
+	}
+
+	return w.Name + "/" + p.Context
+}
+
+// Fingerprint identifies the differences other than metadata, it is empty if
+// there are none
+func Fingerprint(diffs []report.DiffReport) string {
+	lines := []string{}
+	for _, d := range diffs {
+		if d.Kind == report.ChangeMetadata {
+			continue
+		}
+		lines = append(lines, d.Kind+" "+d.String())
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// send posts p to the webhook w and retries failed requests
+func (n *Notifier) send(w Webhook, p Payload) error {
+	body, err := encode(w, p)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(w, body)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single request, it returns whether a failure may be retried
+func (n *Notifier) post(w Webhook, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if len(w.secret) != 0 {
+		req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	}
+
+	client := *n.client
+	client.Timeout = w.Timeout
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// Sign returns the value of the SignatureHeader for body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// encode creates the body of the request for p
+func encode(w Webhook, p Payload) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(p)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := w.template.Execute(buf, p); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// save persists the state if a state file is configured
+func (n *Notifier) save() error {
+	if n.config.StateFile == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(n.state)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(n.config.StateFile, raw, 0600)
+}
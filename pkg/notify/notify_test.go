@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+// receiver records the requests of a webhook and fails the first ones
+type receiver struct {
+	mu       sync.Mutex
+	fail     int
+	bodies   []string
+	sigs     []string
+	attempts int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts++
+	if r.fail > 0 {
+		r.fail--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	r.bodies = append(r.bodies, string(body))
+	r.sigs = append(r.sigs, req.Header.Get(SignatureHeader))
+}
+
+func payload(names ...string) Payload {
+	p := Payload{
+		Server: report.Server{Host: "https://cluster"},
+		Differences: []report.DiffReport{
+			{Element: "ScanStart", A: "1", B: "2", Kind: report.ChangeMetadata},
+		},
+	}
+
+	for _, n := range names {
+		p.Differences = append(p.Differences, report.DiffReport{Element: "ResourceObject v1 namespaces//" + n, A: "does not exist", B: "exists", Kind: report.ChangeAdded})
+	}
+
+	return p
+}
+
+func TestNotify(t *testing.T) {
+	r := &receiver{fail: 2}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n, err := New(Config{Webhooks: []Webhook{{
+		Name:     "chat",
+		URL:      srv.URL,
+		Secret:   "secret",
+		Template: `{"text": {{ printf "%d differences on %s" (len .Differences) .Server.Host | json }}}`,
+		Retries:  2,
+		Backoff:  time.Millisecond,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sent after two retries
+	if err := n.Notify(payload("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unresolved differences are not sent again, even if the metadata changed
+	p := payload("a")
+	p.Differences[0].B = "3"
+	if err := n.Notify(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resolved and reappeared
+	if err := n.Notify(payload()); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(payload("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"text": "2 differences on https://cluster"}`
+	if r.attempts != 4 || len(r.bodies) != 2 || r.bodies[0] != exp {
+		t.Fatalf("Got %d attempts and bodies %v, expected 4 and %s twice", r.attempts, r.bodies, exp)
+	}
+
+	if r.sigs[0] != Sign([]byte("secret"), []byte(exp)) {
+		t.Errorf("Got signature %s", r.sigs[0])
+	}
+}
+
+func TestNotifyFailure(t *testing.T) {
+	r := &receiver{fail: 10}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n, err := New(Config{Webhooks: []Webhook{{Name: "ops", URL: srv.URL, Retries: 1, Backoff: time.Millisecond}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Notify(payload("a")); err == nil {
+		t.Error("Expected an error")
+	}
+
+	// Failed notifications are retried on the next run
+	r.fail = 0
+	if err := n.Notify(payload("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.attempts != 3 || len(r.bodies) != 1 || r.sigs[0] != "" {
+		t.Errorf("Got %d attempts, bodies %v and signatures %v", r.attempts, r.bodies, r.sigs)
+	}
+}
+
+func TestNotifyStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubewire-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	config := Config{
+		Webhooks:  []Webhook{{Name: "ops", URL: srv.URL}},
+		StateFile: filepath.Join(dir, "state.json"),
+	}
+
+	// Two runs e.g. of a CronJob
+	for i := 0; i < 2; i++ {
+		n, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := n.Notify(payload("a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(r.bodies) != 1 {
+		t.Errorf("Got %d notifications, expected 1", len(r.bodies))
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, w := range []Webhook{{URL: "http://x"}, {Name: "x"}, {Name: "x", URL: "http://x", Template: "{{"}} {
+		if _, err := New(Config{Webhooks: []Webhook{w}}); err == nil {
+			t.Errorf("Expected an error for %+v", w)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"errors"
+)
+
+// ErrQueueFull is returned by Enqueue if the payload was dropped
+var ErrQueueFull = errors.New("notification queue is full, payload dropped")
+
+// Queue notifies the webhooks in the background, so that slow or retried
+// requests do not block the caller e.g. a watch loop. The number of pending
+// payloads is bounded, further ones are dropped.
+type Queue struct {
+	notifier *Notifier
+	payloads chan Payload
+	done     chan struct{}
+	onError  func(error)
+}
+
+// NewQueue starts notifying the payloads of a queue of size with n, the errors
+// of the notifications are passed to onError
+func NewQueue(n *Notifier, size int, onError func(error)) *Queue {
+	q := &Queue{
+		notifier: n,
+		payloads: make(chan Payload, size),
+		done:     make(chan struct{}),
+		onError:  onError,
+	}
+
+	go q.run()
+
+	return q
+}
+
+// run notifies the queued payloads until the queue is closed
+func (q *Queue) run() {
+	defer close(q.done)
+
+	for p := range q.payloads {
+		if err := q.notifier.Notify(p); err != nil {
+			q.onError(err)
+		}
+	}
+}
+
+// Enqueue adds p to the queue without blocking, it returns ErrQueueFull if p
+// was dropped
+func (q *Queue) Enqueue(p Payload) error {
+	select {
+	case q.payloads <- p:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting payloads and waits until the queued ones are notified
+func (q *Queue) Close() {
+	close(q.payloads)
+	<-q.done
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	r := &receiver{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+		r.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	n, err := New(Config{Webhooks: []Webhook{{Name: "ops", URL: srv.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu := sync.Mutex{}
+	errs := []error{}
+	q := NewQueue(n, 1, func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+
+	// The first payload blocks in the request, the second one is queued and
+	// the third one dropped without blocking
+	if err := q.Enqueue(payload("a")); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	if err := q.Enqueue(payload("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(payload("c")); err != ErrQueueFull {
+		t.Errorf("Got %v, expected %v", err, ErrQueueFull)
+	}
+
+	close(release)
+	q.Close()
+
+	if len(r.bodies) != 2 || len(errs) != 0 {
+		t.Errorf("Got bodies %v and errors %v, expected two bodies", r.bodies, errs)
+	}
+}
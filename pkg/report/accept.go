@@ -0,0 +1,102 @@
+package report
+
+import (
+	"sort"
+	"time"
+)
+
+// Acceptance records who accepted which differences to a baseline and why
+type Acceptance struct {
+	Time   time.Time
+	User   string
+	Reason string
+	// Selector defines the rule which selected the accepted differences
+	Selector IgnoreRule
+	Accepted []DiffReport
+}
+
+// Accept applies the differences of the resources and resource objects
+// between the baseline a and the snapshot b, which are matched by the compiled
+// selector, to a copy of a. Differences of unknown state e.g. of resources which
+// could not be listed are never accepted. The updated baseline and the accepted
+// differences are returned.
+func Accept(a, b Report, selector *Ignore) (Report, []DiffReport) {
+	resources := map[string]Resource{}
+	for _, r := range b.Resources {
+		resources[r.Key()] = r
+	}
+
+	objects := map[string]ResourceObject{}
+	for _, o := range b.ResourceObjects {
+		objects[o.Key()] = o
+	}
+
+	// The keys of the accepted resources and resource objects with the kind
+	// of their change
+	acceptedResources := map[string]string{}
+	acceptedObjects := map[string]string{}
+
+	accepted := []DiffReport{}
+	for _, d := range DiffReports(a, b, nil).Differences {
+		switch d.Kind {
+		case ChangeAdded, ChangeRemoved, ChangeModified, ChangeRecreated, ChangeNewManager:
+		default:
+			continue
+		}
+
+		switch {
+		case d.Resource != nil && selector.Match(*d.Resource, d.Kind) >= 0:
+			acceptedResources[d.Resource.Key()] = d.Kind
+		case d.ResourceObject != nil && selector.Match(*d.ResourceObject, d.Kind) >= 0:
+			acceptedObjects[d.ResourceObject.Key()] = d.Kind
+		default:
+			continue
+		}
+
+		accepted = append(accepted, d)
+	}
+
+	ret := a
+	ret.Resources = []Resource{}
+	for _, r := range a.Resources {
+		switch acceptedResources[r.Key()] {
+		case ChangeRemoved:
+			continue
+		case ChangeModified:
+			r = resources[r.Key()]
+		}
+		ret.Resources = append(ret.Resources, r)
+	}
+
+	ret.ResourceObjects = []ResourceObject{}
+	for _, o := range a.ResourceObjects {
+		switch acceptedObjects[o.Key()] {
+		case ChangeRemoved:
+			continue
+		case ChangeModified, ChangeRecreated, ChangeNewManager:
+			// The object is replaced with its content and metadata of b
+			o = objects[o.Key()]
+		}
+		ret.ResourceObjects = append(ret.ResourceObjects, o)
+	}
+
+	for key, kind := range acceptedResources {
+		if kind == ChangeAdded {
+			ret.Resources = append(ret.Resources, resources[key])
+		}
+	}
+
+	for key, kind := range acceptedObjects {
+		if kind == ChangeAdded {
+			ret.ResourceObjects = append(ret.ResourceObjects, objects[key])
+		}
+	}
+
+	sort.Sort(ResourceSort(ret.Resources))
+	sort.Sort(ResourceObjectSort(ret.ResourceObjects))
+
+	// The audit trail must not be shared with a
+	ret.Audit = append([]Acceptance{}, a.Audit...)
+
+	return ret, accepted
+}
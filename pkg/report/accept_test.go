@@ -0,0 +1,76 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAccept(t *testing.T) {
+	a := Report{
+		Resources: []Resource{{GroupVersion: "v1", Name: "configmaps", Kind: "ConfigMap"}},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "coredns", Hash: "sha256:1"},
+			{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "old", Hash: "sha256:2"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "keep", Hash: "sha256:3"},
+		},
+		Audit: []Acceptance{{User: "alice"}},
+	}
+	b := Report{
+		Resources: []Resource{{GroupVersion: "v1", Name: "configmaps", Kind: "ConfigMap"}, {GroupVersion: "v1", Name: "secrets", Kind: "Secret"}},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "coredns", Hash: "sha256:4"},
+			{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "new", Hash: "sha256:5"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "added", Hash: "sha256:6"},
+		},
+	}
+
+	// Accept the changes of all configmaps, but not of secrets
+	ret, accepted := Accept(a, b, newIgnore(t, IgnoreRule{Resource: "configmaps"}))
+
+	exp := []ResourceObject{
+		{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "coredns", Hash: "sha256:4"},
+		{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "new", Hash: "sha256:5"},
+		{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "keep", Hash: "sha256:3"},
+	}
+	if !reflect.DeepEqual(ret.ResourceObjects, exp) {
+		t.Errorf("Got objects %+v, expected %+v", ret.ResourceObjects, exp)
+	}
+
+	if !reflect.DeepEqual(ret.Resources, a.Resources) {
+		t.Errorf("Got resources %+v, expected %+v", ret.Resources, a.Resources)
+	}
+
+	if len(accepted) != 3 {
+		t.Errorf("Got %d accepted differences, expected 3: %+v", len(accepted), accepted)
+	}
+
+	// a must not be modified
+	if len(a.ResourceObjects) != 3 || a.ResourceObjects[0].Hash != "sha256:1" {
+		t.Errorf("Baseline has been modified: %+v", a.ResourceObjects)
+	}
+
+	// Restricted to added objects and resources
+	ret, accepted = Accept(a, b, newIgnore(t, IgnoreRule{Changes: []string{ChangeAdded}}))
+	if len(accepted) != 3 || len(ret.Resources) != 2 || len(ret.ResourceObjects) != 5 {
+		t.Errorf("Got unexpected result %+v, accepted %+v", ret, accepted)
+	}
+
+	if len(ret.Audit) != 1 {
+		t.Errorf("Got audit %+v, expected the one of the baseline", ret.Audit)
+	}
+}
+
+func TestAcceptUnknown(t *testing.T) {
+	a := Report{
+		ResourceObjects: []ResourceObject{{GroupVersion: "v1", Resource: "configmaps", Namespace: "default", Name: "x"}},
+	}
+	b := Report{
+		ResourceObjects: []ResourceObject{},
+		Errors:          []RetrievalError{{GroupVersion: "v1", Resource: "configmaps", Namespace: "default", Message: "forbidden"}},
+	}
+
+	ret, accepted := Accept(a, b, newIgnore(t, IgnoreRule{}))
+	if len(accepted) != 0 || len(ret.ResourceObjects) != 1 {
+		t.Errorf("Expected objects of unknown state not to be accepted, got %+v", accepted)
+	}
+}
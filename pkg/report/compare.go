@@ -0,0 +1,116 @@
+package report
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Normalization defines how the names of resource objects of different
+// clusters are made comparable
+type Normalization struct {
+	Names []NameRule
+}
+
+// NameRule rewrites the names of resource objects matching Pattern, e.g. to
+// strip the random suffixes of '*-token-xxxxx' secrets. Resource and
+// Namespace are patterns like the ones of IgnoreRule.
+type NameRule struct {
+	Description string `yaml:",omitempty" json:",omitempty"`
+	Resource    string `yaml:",omitempty" json:",omitempty"`
+	Namespace   string `yaml:",omitempty" json:",omitempty"`
+	// Pattern is a regular expression matched against the name
+	Pattern string
+	// Replacement replaces the matches of Pattern, it may refer to submatches
+	// e.g. ${1}
+	Replacement string
+
+	resource  matcher
+	namespace matcher
+	re        *regexp.Regexp
+}
+
+// Compile validates and prepares all rules, it must be called before
+// normalizing
+func (n *Normalization) Compile() error {
+	for r := range n.Names {
+		if err := n.Names[r].compile(); err != nil {
+			return fmt.Errorf("name rule %d: %s", r+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *NameRule) compile() error {
+	var err error
+
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+
+	r.re, err = regexp.Compile(r.Pattern)
+	if err != nil {
+		return err
+	}
+
+	r.resource, err = newMatcher(r.Resource)
+	if err != nil {
+		return err
+	}
+
+	r.namespace, err = newMatcher(r.Namespace)
+	return err
+}
+
+// Name returns the normalized name of the resource object o, which is the
+// name rewritten by the first matching rule
+func (n *Normalization) Name(o ResourceObject) string {
+	if n == nil {
+		return o.Name
+	}
+
+	for _, r := range n.Names {
+		if r.resource(o.Resource) && r.namespace(o.Namespace) && r.re.MatchString(o.Name) {
+			return r.re.ReplaceAllString(o.Name, r.Replacement)
+		}
+	}
+
+	return o.Name
+}
+
+// CompareReports compares the reports a and b of different clusters. Only
+// resources and resource objects are compared, the per cluster metadata like
+// the scan times, the server and the configuration is not. The names of the
+// resource objects are normalized by names, which may be nil and must be
+// compiled otherwise. Objects with the same normalized name are only compared
+// once. ignore is applied like by DiffReports.
+func CompareReports(a, b Report, names *Normalization, ignore *Ignore) DiffResult {
+	return DiffReports(normalizedReport(a, names), normalizedReport(b, names), ignore)
+}
+
+// normalizedReport returns the resources, resource objects and errors of rep with
+// normalized object names
+func normalizedReport(rep Report, names *Normalization) Report {
+	objects := make([]ResourceObject, 0, len(rep.ResourceObjects))
+	for _, o := range rep.ResourceObjects {
+		o.Name = names.Name(o)
+		objects = append(objects, o)
+	}
+	sort.Stable(ResourceObjectSort(objects))
+
+	// Remove the objects with the same normalized name
+	unique := objects[:0]
+	for _, o := range objects {
+		if len(unique) > 0 && o.Key() == unique[len(unique)-1].Key() {
+			continue
+		}
+		unique = append(unique, o)
+	}
+
+	return Report{
+		Resources:       rep.Resources,
+		ResourceObjects: unique,
+		Errors:          rep.Errors,
+	}
+}
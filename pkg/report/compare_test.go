@@ -0,0 +1,64 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizationCompileInvalid(t *testing.T) {
+	for _, r := range []NameRule{{}, {Pattern: "("}, {Pattern: "x", Resource: "[a"}} {
+		n := &Normalization{Names: []NameRule{r}}
+		if err := n.Compile(); err == nil {
+			t.Errorf("Expected an error for %+v", r)
+		}
+	}
+}
+
+func TestCompareReports(t *testing.T) {
+	names := &Normalization{Names: []NameRule{
+		{Resource: "secrets", Pattern: `^(.*-token-)[a-z0-9]{5}$`, Replacement: "${1}xxxxx"},
+	}}
+	if err := names.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := Report{
+		ScanStart: time.Unix(0, 0),
+		Server:    Server{Host: "https://staging", Version: "v1.11.1"},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "v1", Resource: "namespaces", Name: "only-staging"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "kube-system", Name: "default-token-abcde"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "kube-system", Name: "default-token-fghij"},
+		},
+		Configuration: Configuration{Namespaces: []string{"kube-system"}, Context: "staging"},
+	}
+	b := Report{
+		ScanStart: time.Unix(100, 0),
+		Server:    Server{Host: "https://prod", Version: "v1.11.2"},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "v1", Resource: "namespaces", Name: "only-prod"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "kube-system", Name: "default-token-klmno"},
+		},
+		Configuration: Configuration{Namespaces: []string{"kube-system"}, Context: "prod"},
+	}
+
+	result := CompareReports(a, b, names, nil)
+
+	exp := []string{
+		"Element: ResourceObject v1 namespaces//only-prod, A: does not exist, B: exists",
+		"Element: ResourceObject v1 namespaces//only-staging, A: exists, B: does not exist",
+	}
+	if len(result.Differences) != len(exp) {
+		t.Fatalf("Got differences %v, expected %v", result.Differences, exp)
+	}
+	for i := range exp {
+		if result.Differences[i].String() != exp[i] {
+			t.Errorf("Got %q, expected %q", result.Differences[i].String(), exp[i])
+		}
+	}
+
+	// The reports must not be modified
+	if a.ResourceObjects[1].Name != "default-token-abcde" {
+		t.Errorf("Report has been modified: %+v", a.ResourceObjects)
+	}
+}
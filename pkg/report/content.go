@@ -0,0 +1,143 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// simpleKey matches map keys which can be written in dot notation
+var simpleKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// ContentDiff compares the object contents a and b field by field and returns
+// one DiffReport for every changed JSON path
+func ContentDiff(a, b interface{}) []DiffReport {
+	return contentDiff(normalizeValue(a), normalizeValue(b), "")
+}
+
+func contentDiff(a, b interface{}, path string) []DiffReport {
+	switch at := a.(type) {
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		// Iterate over the union of the keys in a stable order
+		keys := []string{}
+		for k := range at {
+			keys = append(keys, k)
+		}
+		for k := range bt {
+			if _, ok := at[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		ret := []DiffReport{}
+		for _, k := range keys {
+			av, aok := at[k]
+			bv, bok := bt[k]
+			sub := joinPath(path, k)
+
+			switch {
+			case !aok:
+				ret = append(ret, fieldDiff(sub, "does not exist", encodeValue(bv)))
+			case !bok:
+				ret = append(ret, fieldDiff(sub, encodeValue(av), "does not exist"))
+			default:
+				ret = append(ret, contentDiff(av, bv, sub)...)
+			}
+		}
+
+		return ret
+
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+
+		ret := []DiffReport{}
+		for i := 0; i < len(at) || i < len(bt); i++ {
+			sub := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case i >= len(at):
+				ret = append(ret, fieldDiff(sub, "does not exist", encodeValue(bt[i])))
+			case i >= len(bt):
+				ret = append(ret, fieldDiff(sub, encodeValue(at[i]), "does not exist"))
+			default:
+				ret = append(ret, contentDiff(at[i], bt[i], sub)...)
+			}
+		}
+
+		return ret
+	}
+
+	// Leaves and values of different types are compared by their encoding, as
+	// numbers are decoded to different types depending on the snapshot format
+	aenc := encodeValue(a)
+	benc := encodeValue(b)
+	if aenc != benc {
+		return []DiffReport{fieldDiff(path, aenc, benc)}
+	}
+
+	return nil
+}
+
+func fieldDiff(path, a, b string) DiffReport {
+	return DiffReport{Element: "Content." + path, A: a, B: b, Path: path}
+}
+
+// joinPath appends the map key k to the JSON path
+func joinPath(path, k string) string {
+	if !simpleKey.MatchString(k) {
+		return fmt.Sprintf("%s[%q]", path, k)
+	}
+
+	if path == "" {
+		return k
+	}
+
+	return path + "." + k
+}
+
+// encodeValue returns the compact JSON representation of v
+func encodeValue(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(raw)
+}
+
+// normalizeValue converts the maps decoded by yaml into maps with string keys,
+// so that contents of yaml and json snapshots are comparable
+func normalizeValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[fmt.Sprint(k)] = normalizeValue(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = normalizeValue(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, v := range t {
+			l[i] = normalizeValue(v)
+		}
+		return l
+	}
+
+	return v
+}
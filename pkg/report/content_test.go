@@ -0,0 +1,83 @@
+package report
+
+import (
+	"encoding/json"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestContentDiffEqual(t *testing.T) {
+	a := map[string]interface{}{"rules": []interface{}{map[string]interface{}{"verbs": []interface{}{"get"}}}}
+	b := map[interface{}]interface{}{"rules": []interface{}{map[interface{}]interface{}{"verbs": []interface{}{"get"}}}}
+	exp := []string{}
+	compare(ContentDiff(a, b), exp, t)
+}
+
+func TestContentDiffNumbers(t *testing.T) {
+	a := map[string]interface{}{"replicas": int64(3)}
+	b := map[string]interface{}{"replicas": float64(3)}
+	exp := []string{}
+	compare(ContentDiff(a, b), exp, t)
+}
+
+func TestContentDiffList(t *testing.T) {
+	a := map[string]interface{}{"rules": []interface{}{
+		map[string]interface{}{"verbs": []interface{}{"get"}},
+		map[string]interface{}{"verbs": []interface{}{"get", "list"}},
+	}}
+	b := map[string]interface{}{"rules": []interface{}{
+		map[string]interface{}{"verbs": []interface{}{"get"}},
+		map[string]interface{}{"verbs": []interface{}{"get", "delete"}},
+		map[string]interface{}{"verbs": []interface{}{"*"}},
+	}}
+	exp := []string{
+		`Element: Content.rules[1].verbs[1], A: "list", B: "delete"`,
+		`Element: Content.rules[2], A: does not exist, B: {"verbs":["*"]}`,
+	}
+	compare(ContentDiff(a, b), exp, t)
+}
+
+func TestContentDiffMap(t *testing.T) {
+	a := map[string]interface{}{"metadata": map[string]interface{}{
+		"annotations": map[string]interface{}{"kubernetes.io/description": "x"},
+		"labels":      map[string]interface{}{"app": "x"},
+	}}
+	b := map[string]interface{}{"metadata": map[string]interface{}{
+		"annotations": map[string]interface{}{"kubernetes.io/description": "y"},
+	}}
+	exp := []string{
+		`Element: Content.metadata.annotations["kubernetes.io/description"], A: "x", B: "y"`,
+		`Element: Content.metadata.labels, A: {"app":"x"}, B: does not exist`,
+	}
+	compare(ContentDiff(a, b), exp, t)
+}
+
+func TestDiffResourceObjectsFields(t *testing.T) {
+	a := []Keyer{ResourceObject{Name: "x1", Hash: "sha256:1", Content: map[string]interface{}{"data": map[string]interface{}{"k": "1"}}}}
+	b := []Keyer{ResourceObject{Name: "x1", Hash: "sha256:2", Content: map[string]interface{}{"data": map[string]interface{}{"k": "2"}}}}
+	results := Diff(a, b)
+	exp := []string{`Element:     x1.Content.data.k, A: "1", B: "2"`}
+	compare(results, exp, t)
+
+	if len(results) == 1 && results[0].Path != "data.k" {
+		t.Errorf("Got path %s, expected data.k", results[0].Path)
+	}
+}
+
+func TestResourceObjectUnmarshalYAML(t *testing.T) {
+	raw := []byte("resourceobjects:\n- groupversion: v1\n  resource: configmaps\n  content:\n    data:\n      x: \"1\"\n    list:\n    - a: b\n")
+	rep := Report{}
+	if err := yaml.Unmarshal(raw, &rep); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(rep.ResourceObjects[0].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"data":{"x":"1"},"list":[{"a":"b"}]}`; string(out) != exp {
+		t.Errorf("Got %s, expected %s", out, exp)
+	}
+}
@@ -1,19 +1,118 @@
 package report
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Change types of a difference
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+	// ChangeSchema is any change of the served API resources
+	ChangeSchema = "resource-schema"
+	// ChangeMetadata is a change of the scan itself e.g. ScanStart
+	ChangeMetadata = "metadata"
+	// ChangeUnknown is an element which exists in one report, but could not be
+	// retrieved for the other
+	ChangeUnknown = "unknown"
+	// ChangeRecreated is a resource object which was deleted and created again
+	// with the same name, its UID changed
+	ChangeRecreated = "recreated"
+	// ChangeNewManager is a resource object which was changed by a field
+	// manager that did not manage it before e.g. kubectl-edit
+	ChangeNewManager = "new-field-manager"
+)
+
+// Categories of a difference
+const (
+	CategoryResource       = "resource"
+	CategoryResourceObject = "resourceobject"
+	CategoryServer         = "server"
+	CategoryConfiguration  = "configuration"
+)
+
+// Severities of a difference
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// DiffSchemaVersion is the version of the DiffResult format, it changes on
+// incompatible modifications
+const DiffSchemaVersion = "v1"
+
+// DefaultFailOn lists the change types which are considered as drift by default
+var DefaultFailOn = []string{ChangeAdded, ChangeRemoved, ChangeModified, ChangeSchema, ChangeRecreated, ChangeNewManager}
 
 // DiffReport defines the type for a single diffing result where A is the
-// old and B is the new value of Element
+// old and B is the new value of Element.
+// Differences of resources and resource objects also hold their identity.
 type DiffReport struct {
-	Element string
-	A       string
-	B       string
+	Element        string
+	A              string
+	B              string
+	Path           string          `yaml:",omitempty" json:",omitempty"` // JSON path of a changed field in the object content
+	Kind           string          // added|removed|modified|resource-schema|metadata|unknown|recreated|new-field-manager
+	Category       string          // resource|resourceobject|server|configuration
+	Severity       string          // info|warning|critical
+	Resource       *Resource       `yaml:",omitempty" json:",omitempty"`
+	ResourceObject *ResourceObject `yaml:",omitempty" json:",omitempty"`
+	// LastChange is the last recorded change of the resource object e.g. by the
+	// admission webhook
+	LastChange *Change `yaml:",omitempty" json:",omitempty"`
+	// AuditEvents are the changes of the resource object in the audit log of
+	// the API server between the scans, the latest last
+	AuditEvents []Change `yaml:",omitempty" json:",omitempty"`
 }
 
 func (r DiffReport) String() string {
 	return fmt.Sprintf("Element: %s, A: %s, B: %s", r.Element, r.A, r.B)
 }
 
+// Change records who changed a resource object and when
+type Change struct {
+	Time      time.Time
+	User      string
+	Groups    []string `yaml:",omitempty" json:",omitempty"`
+	Operation string   // CREATE|UPDATE|DELETE
+	// Verb, UserAgent and SourceIPs are only known from audit logs
+	Verb      string   `yaml:",omitempty" json:",omitempty"` // e.g. patch
+	UserAgent string   `yaml:",omitempty" json:",omitempty"`
+	SourceIPs []string `yaml:",omitempty" json:",omitempty"`
+}
+
+// String returns a human readable description e.g. "created by alice at
+// 2018-06-12T12:19:14Z"
+func (c Change) String() string {
+	verb := strings.ToLower(c.Operation)
+	if c.Verb != "" {
+		verb = c.Verb
+	}
+
+	switch verb {
+	case "create", "update", "delete":
+		verb = strings.TrimSuffix(verb, "e") + "ed"
+	case "patch":
+		verb = "patched"
+	case "deletecollection":
+		verb = "deleted with collection"
+	}
+
+	ret := verb + " by " + c.User
+	if len(c.SourceIPs) != 0 {
+		ret += " from " + strings.Join(c.SourceIPs, ",")
+	}
+	if c.UserAgent != "" {
+		ret += " with " + c.UserAgent
+	}
+
+	return ret + " at " + c.Time.Format(time.RFC3339)
+}
+
 // Keyer defines an interface which can uniquely identify and compare types
 // together in order to diff them
 type Keyer interface {
@@ -29,53 +128,283 @@ func AnnotateDiffReports(r []DiffReport, prefix string) {
 	}
 }
 
+// identify sets the kind, unless Compare already set one, and the identity of
+// k
+func identify(r []DiffReport, k Keyer, kind string) {
+	for i := range r {
+		if r[i].Kind == "" {
+			r[i].Kind = kind
+		}
+
+		switch t := k.(type) {
+		case Resource:
+			r[i].Resource = &t
+		case ResourceObject:
+			// The content and metadata are not part of the identity
+			t.Content = nil
+			t.Metadata = nil
+			r[i].ResourceObject = &t
+		}
+	}
+}
+
+// categorize sets the category and severity of every DiffReport
+func categorize(r []DiffReport, category, severity string) {
+	for i := range r {
+		r[i].Category = category
+		r[i].Severity = severity
+	}
+}
+
+// DiffResult holds the differences between two reports
+type DiffResult struct {
+	SchemaVersion string
+	Differences   []DiffReport
+	Ignored       []IgnoreCount
+	// Changes counts the differing elements, resources and resource objects by
+	// their change type, ignored differences are not counted
+	Changes map[string]int
+}
+
+// Drift returns true if there are differences of one of the change types
+func (r DiffResult) Drift(changes []string) bool {
+	for _, c := range changes {
+		if r.Changes[c] != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 // DiffReports creates a DiffReport between a and b.
-// Resources and ResourceObjects from a and b must be sorted
-func DiffReports(a Report, b Report) []DiffReport {
+// Resources and ResourceObjects from a and b must be sorted.
+// Differences matching a rule of ignore are left out and only counted, ignore
+// may be nil and must be compiled otherwise
+func DiffReports(a Report, b Report, ignore *Ignore) DiffResult {
 	ret := []DiffReport{}
+	changes := map[string]int{}
+
+	counts := []IgnoreCount{}
+	if ignore != nil {
+		for _, r := range ignore.Rules {
+			counts = append(counts, IgnoreCount{Rule: r})
+		}
+	}
+
+	// add appends a difference of report elements if it is not ignored
+	add := func(element, av, bv string, category string, change string) {
+		if n := ignore.MatchElement(element, ChangeModified); n != -1 {
+			counts[n].Count++
+			return
+		}
+
+		severity := SeverityWarning
+		if change == ChangeMetadata {
+			severity = SeverityInfo
+		}
+
+		changes[change]++
+		ret = append(ret, DiffReport{Element: element, A: av, B: bv, Kind: change, Category: category, Severity: severity})
+	}
+
+	// Objects which are only listed in another version of their group are not
+	// added or removed, the version change is reported for the resource and
+	// the objects are compared across the versions
+	moved := movedObjects(a, b)
+
+	// filter reports differences of resources and resource objects which are
+	// not ignored
+	filter := func(k Keyer, change string) bool {
+		if o, ok := k.(ResourceObject); ok && (change == ChangeAdded || change == ChangeRemoved) {
+			if _, ok := moved[o.Key()]; ok {
+				return false
+			}
+		}
+
+		if n := ignore.Match(k, change); n != -1 {
+			counts[n].Count++
+			return false
+		}
+
+		if _, ok := k.(Resource); ok {
+			change = ChangeSchema
+		}
+		changes[change]++
+
+		return true
+	}
 
 	if a.ScanStart != b.ScanStart {
-		ret = append(ret, DiffReport{Element: "ScanStart", A: a.ScanStart.String(), B: b.ScanStart.String()})
+		add("ScanStart", a.ScanStart.String(), b.ScanStart.String(), CategoryConfiguration, ChangeMetadata)
 	}
 
 	if a.ScanEnd != b.ScanEnd {
-		ret = append(ret, DiffReport{Element: "ScanEnd", A: a.ScanEnd.String(), B: b.ScanEnd.String()})
+		add("ScanEnd", a.ScanEnd.String(), b.ScanEnd.String(), CategoryConfiguration, ChangeMetadata)
 	}
 
 	// Configuration
 	if a.Configuration.KubewireVersion != b.Configuration.KubewireVersion {
-		ret = append(ret, DiffReport{Element: "Configuration.KubewireVersion", A: a.Configuration.KubewireVersion, B: b.Configuration.KubewireVersion})
+		add("Configuration.KubewireVersion", a.Configuration.KubewireVersion, b.Configuration.KubewireVersion, CategoryConfiguration, ChangeMetadata)
 	}
 
 	// Configuration.Namespaces
 	ans := fmt.Sprintf("%v", a.Configuration.Namespaces)
 	bns := fmt.Sprintf("%v", b.Configuration.Namespaces)
 	if ans != bns {
-		ret = append(ret, DiffReport{Element: "Configuration.Namespaces", A: ans, B: bns})
+		add("Configuration.Namespaces", ans, bns, CategoryConfiguration, ChangeModified)
 	}
 
 	// Server
 	if a.Server.Host != b.Server.Host {
-		ret = append(ret, DiffReport{Element: "Server.Host", A: a.Server.Host, B: b.Server.Host})
+		add("Server.Host", a.Server.Host, b.Server.Host, CategoryServer, ChangeModified)
 	}
 	if a.Server.Version != b.Server.Version {
-		ret = append(ret, DiffReport{Element: "Server.Version", A: a.Server.Version, B: b.Server.Version})
+		add("Server.Version", a.Server.Version, b.Server.Version, CategoryServer, ChangeModified)
 	}
 
 	// Resources
-	cmp := Diff(resourcesToKeyer(a.Resources), resourcesToKeyer(b.Resources))
+	cmp := DiffFiltered(resourcesToKeyer(a.Resources), resourcesToKeyer(b.Resources), filter)
 	if len(cmp) != 0 {
+		categorize(cmp, CategoryResource, SeverityWarning)
 		AnnotateDiffReports(cmp, "Resource ")
 		ret = append(ret, cmp...)
 	}
 
 	// ResourceObject
-	cmp = Diff(resourceobjectsToKeyer(a.ResourceObjects), resourceobjectsToKeyer(b.ResourceObjects))
-	if len(cmp) != 0 {
-		AnnotateDiffReports(cmp, "ResourceObject ")
-		ret = append(ret, cmp...)
+	ret = append(ret, diffResourceObjects(a.ResourceObjects, b.ResourceObjects, filter)...)
+	ret = append(ret, diffMovedObjects(a.ResourceObjects, moved, filter)...)
+
+	markUnknown(ret, a.Errors, b.Errors, changes)
+
+	return DiffResult{
+		SchemaVersion: DiffSchemaVersion,
+		Differences:   ret,
+		Ignored:       counts,
+		Changes:       changes,
+	}
+}
+
+// movedObjects maps the keys of the resource objects, whose version is not
+// served in the other report, to the same object in another version of their
+// group there. Resources served by different groups e.g. deployments by apps
+// and extensions are different objects for the API server, so their objects
+// are not moved.
+func movedObjects(a, b Report) map[string]ResourceObject {
+	ret := map[string]ResourceObject{}
+
+	mark := func(x, y Report) {
+		// Without resources it is not known which versions are served
+		if len(y.Resources) == 0 {
+			return
+		}
+
+		served := map[string]bool{}
+		for _, res := range y.Resources {
+			served[res.GroupVersion+" "+res.Name] = true
+		}
+
+		// The first version of an object in the other report is compared
+		objects := map[string]ResourceObject{}
+		id := func(o ResourceObject) string {
+			group, _ := SplitGroupVersionSafe(o.GroupVersion)
+			return group + " " + o.Resource + " " + o.Namespace + " " + o.Name
+		}
+		for _, o := range y.ResourceObjects {
+			if _, ok := objects[id(o)]; !ok {
+				objects[id(o)] = o
+			}
+		}
+
+		for _, o := range x.ResourceObjects {
+			if other, ok := objects[id(o)]; ok && !served[o.GroupVersion+" "+o.Resource] {
+				ret[o.Key()] = other
+			}
+		}
+	}
+
+	mark(a, b)
+	mark(b, a)
+
+	return ret
+}
+
+// markUnknown changes the added and removed resources and resource objects to
+// unknown, if they could not be retrieved for the other report
+func markUnknown(r []DiffReport, aerrs, berrs []RetrievalError, changes map[string]int) {
+	covered := func(d DiffReport, errs []RetrievalError) bool {
+		for _, e := range errs {
+			if (d.Resource != nil && e.CoversResource(*d.Resource)) ||
+				(d.ResourceObject != nil && e.Covers(*d.ResourceObject)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for i, d := range r {
+		switch {
+		case d.Kind == ChangeRemoved && covered(d, berrs):
+			r[i].B = ChangeUnknown
+		case d.Kind == ChangeAdded && covered(d, aerrs):
+			r[i].A = ChangeUnknown
+		default:
+			continue
+		}
+
+		// Resources are counted as schema change
+		counted := d.Kind
+		if d.Resource != nil {
+			counted = ChangeSchema
+		}
+		changes[counted]--
+		changes[ChangeUnknown]++
+
+		r[i].Kind = ChangeUnknown
+		r[i].Severity = SeverityWarning
+	}
+}
+
+// DiffResourceObjects creates the differences between the resource objects a
+// and b, which must be sorted. Differences matching a rule of ignore are left
+// out, ignore may be nil and must be compiled otherwise
+func DiffResourceObjects(a, b []ResourceObject, ignore *Ignore) []DiffReport {
+	return diffResourceObjects(a, b, func(k Keyer, change string) bool {
+		return ignore.Match(k, change) == -1
+	})
+}
+
+func diffResourceObjects(a, b []ResourceObject, filter Filter) []DiffReport {
+	cmp := DiffFiltered(resourceobjectsToKeyer(a), resourceobjectsToKeyer(b), filter)
+	categorize(cmp, CategoryResourceObject, SeverityCritical)
+	AnnotateDiffReports(cmp, "ResourceObject ")
+
+	return cmp
+}
+
+// diffMovedObjects compares the moved objects of a with their version in the
+// other report, if that version is not served in a either. Otherwise the
+// object is compared in that version already. The differences are reported for
+// the object in the other version.
+func diffMovedObjects(a []ResourceObject, moved map[string]ResourceObject, filter Filter) []DiffReport {
+	ret := []DiffReport{}
+	for _, o := range a {
+		other, ok := moved[o.Key()]
+		if !ok {
+			continue
+		}
+		if _, ok := moved[other.Key()]; !ok {
+			continue
+		}
+
+		o.GroupVersion = other.GroupVersion
+		ret = append(ret, compareKeyers(o, other, filter)...)
 	}
 
+	categorize(ret, CategoryResourceObject, SeverityCritical)
+	AnnotateDiffReports(ret, "ResourceObject ")
+
 	return ret
 }
 
@@ -99,23 +428,69 @@ func resourceobjectsToKeyer(a []ResourceObject) []Keyer {
 	return t
 }
 
+// Filter decides if the differences of k with the given change type are
+// reported
+type Filter func(k Keyer, change string) bool
+
 // rangeDiff returns a DiffReport for not existing elements over a range
-func rangeDiff(x []Keyer, start int, end int, a bool) []DiffReport {
+func rangeDiff(x []Keyer, start int, end int, a bool, filter Filter) []DiffReport {
 	ret := []DiffReport{}
 	for _, v := range x[start:end] {
+		change := ChangeAdded
 		if a {
-			ret = append(ret, DiffReport{Element: v.String(), A: "exists", B: "does not exist"})
+			change = ChangeRemoved
+		}
+		if filter != nil && !filter(v, change) {
+			continue
+		}
+
+		var r []DiffReport
+		if a {
+			r = []DiffReport{{Element: v.String(), A: "exists", B: "does not exist"}}
 		} else {
-			ret = append(ret, DiffReport{Element: v.String(), B: "exists", A: "does not exist"})
+			r = []DiffReport{{Element: v.String(), B: "exists", A: "does not exist"}}
 		}
+
+		identify(r, v, change)
+		ret = append(ret, r...)
 	}
 
 	return ret
 }
 
+// compareKeyers returns the differences of a and b, which have the same key. Compare
+// may set the change type of a difference, the others are modified. The filter
+// is called once for every change type.
+func compareKeyers(a, b Keyer, filter Filter) []DiffReport {
+	cmp := a.Compare(b)
+	identify(cmp, b, ChangeModified)
+
+	reported := map[string]bool{}
+	ret := []DiffReport{}
+	for _, d := range cmp {
+		if _, ok := reported[d.Kind]; !ok {
+			reported[d.Kind] = filter == nil || filter(b, d.Kind)
+		}
+		if reported[d.Kind] {
+			ret = append(ret, d)
+		}
+	}
+
+	AnnotateDiffReports(ret, a.Key()+".")
+
+	return ret
+}
+
 // Diff creates a difference report betweed a and b. It assumes that the
 // elements in a and b are sorted by Key()
 func Diff(a, b []Keyer) []DiffReport {
+	return DiffFiltered(a, b, nil)
+}
+
+// DiffFiltered creates a difference report between a and b like Diff, but
+// only contains the differences for which filter returns true. A nil filter
+// reports all differences
+func DiffFiltered(a, b []Keyer, filter Filter) []DiffReport {
 	rep := []DiffReport{}
 
 	var aIndex int
@@ -129,15 +504,12 @@ outer:
 			if a[aIndex].Key() == b[bIndexNew].Key() {
 				// Diff skiped elements
 				if bIndex != bIndexNew {
-					cmp := rangeDiff(b, bIndex, bIndexNew, false)
+					cmp := rangeDiff(b, bIndex, bIndexNew, false, filter)
 					rep = append(rep, cmp...)
 				}
 
 				// Append difference of both if there is one
-				if cmp := a[aIndex].Compare(b[bIndexNew]); cmp != nil {
-					AnnotateDiffReports(cmp, a[aIndex].Key()+".")
-					rep = append(rep, cmp...)
-				}
+				rep = append(rep, compareKeyers(a[aIndex], b[bIndexNew], filter)...)
 
 				aIndex++
 				bIndex = bIndexNew + 1
@@ -151,15 +523,12 @@ outer:
 			if a[aIndexNew].Key() == b[bIndex].Key() {
 				// Diff skiped elements
 				if aIndex != aIndexNew {
-					cmp := rangeDiff(a, aIndex, aIndexNew, true)
+					cmp := rangeDiff(a, aIndex, aIndexNew, true, filter)
 					rep = append(rep, cmp...)
 				}
 
 				// Append difference of both if there is one
-				if cmp := a[aIndexNew].Compare(b[bIndex]); cmp != nil {
-					AnnotateDiffReports(cmp, a[aIndexNew].Key()+".")
-					rep = append(rep, cmp...)
-				}
+				rep = append(rep, compareKeyers(a[aIndexNew], b[bIndex], filter)...)
 
 				aIndex = aIndexNew + 1
 				bIndex++
@@ -167,18 +536,25 @@ outer:
 			}
 		}
 
-		// Gone too far
-		break
+		// Neither exists in the other, report the lower one and go on as
+		// both are sorted
+		if a[aIndex].Key() < b[bIndex].Key() {
+			rep = append(rep, rangeDiff(a, aIndex, aIndex+1, true, filter)...)
+			aIndex++
+		} else {
+			rep = append(rep, rangeDiff(b, bIndex, bIndex+1, false, filter)...)
+			bIndex++
+		}
 	}
 
 	// Process the cutoff of a and b
 	if aIndex < len(a) {
-		cmp := rangeDiff(a, aIndex, len(a), true)
+		cmp := rangeDiff(a, aIndex, len(a), true, filter)
 		rep = append(rep, cmp...)
 	}
 
 	if bIndex < len(b) {
-		cmp := rangeDiff(b, bIndex, len(b), false)
+		cmp := rangeDiff(b, bIndex, len(b), false, filter)
 		rep = append(rep, cmp...)
 	}
 
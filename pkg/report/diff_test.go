@@ -1,7 +1,9 @@
 package report
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
 func compare(results []DiffReport, exp []string, t *testing.T) {
@@ -94,3 +96,186 @@ func TestDiffResourcesBInsert2(t *testing.T) {
 	exp := []string{`Element:  /x2, A: exists, B: does not exist`, `Element:  /x3, A: exists, B: does not exist`}
 	compare(Diff(a, b), exp, t)
 }
+
+func TestDiffResourcesReplaced(t *testing.T) {
+	a := []Keyer{Resource{Name: "x1"}, Resource{Name: "x3"}, Resource{Name: "x4"}}
+	b := []Keyer{Resource{Name: "x2"}, Resource{Name: "x4"}}
+	exp := []string{`Element:  /x1, A: exists, B: does not exist`, `Element:  /x2, A: does not exist, B: exists`, `Element:  /x3, A: exists, B: does not exist`}
+	compare(Diff(a, b), exp, t)
+}
+
+func TestDiffResourcesVerbs(t *testing.T) {
+	a := []Keyer{Resource{Name: "x1", Verbs: []string{"list", "get"}}, Resource{Name: "x2", Verbs: []string{"get"}}}
+	b := []Keyer{Resource{Name: "x1", Verbs: []string{"get", "list"}}, Resource{Name: "x2", Verbs: []string{"get", "list"}}}
+	exp := []string{`Element:   x2.Verbs, A: [get], B: [get list]`}
+	compare(Diff(a, b), exp, t)
+}
+
+func TestDiffResourcesVerbsMissing(t *testing.T) {
+	a := []Keyer{Resource{Name: "x1"}}
+	b := []Keyer{Resource{Name: "x1", Verbs: []string{"get", "list"}}}
+	exp := []string{}
+	compare(Diff(a, b), exp, t)
+}
+
+func TestDiffResourceObjectsContent(t *testing.T) {
+	a := []Keyer{ResourceObject{Name: "x1", Hash: "sha256:1"}, ResourceObject{Name: "x2", Hash: "sha256:2"}, ResourceObject{Name: "x3"}}
+	b := []Keyer{ResourceObject{Name: "x1", Hash: "sha256:1"}, ResourceObject{Name: "x2", Hash: "sha256:3"}, ResourceObject{Name: "x3", Hash: "sha256:4"}}
+	exp := []string{`Element:     x2.Content, A: sha256:2, B: sha256:3`}
+	compare(Diff(a, b), exp, t)
+}
+
+func TestDiffReportsDrift(t *testing.T) {
+	a := Report{
+		ScanStart: time.Unix(0, 0),
+		Resources: []Resource{{GroupVersion: "v1", Name: "x1"}},
+	}
+	b := Report{
+		ScanStart:       time.Unix(1, 0),
+		Resources:       []Resource{{GroupVersion: "v1", Name: "x1"}, {GroupVersion: "v1", Name: "x2"}},
+		ResourceObjects: []ResourceObject{{GroupVersion: "v1", Resource: "x1", Name: "o1"}},
+	}
+
+	result := DiffReports(a, b, nil)
+	exp := map[string]int{ChangeMetadata: 1, ChangeSchema: 1, ChangeAdded: 1}
+	if !reflect.DeepEqual(result.Changes, exp) {
+		t.Errorf("Got %v, expected %v", result.Changes, exp)
+	}
+
+	if !result.Drift(DefaultFailOn) {
+		t.Errorf("Expected drift with the default change types")
+	}
+
+	if result.Drift([]string{ChangeRemoved, ChangeModified}) {
+		t.Errorf("Expected no drift for removed and modified")
+	}
+
+	if DiffReports(a, a, nil).Drift(DefaultFailOn) {
+		t.Errorf("Expected no drift between equal reports")
+	}
+}
+
+func TestDiffReportsStructure(t *testing.T) {
+	obj := ResourceObject{GroupVersion: "v1", Resource: "namespaces", Name: "appl-shouldnotbehere", Content: map[string]interface{}{"kind": "Namespace"}}
+	a := Report{Server: Server{Version: "v1.11.5"}}
+	b := Report{Server: Server{Version: "v1.12.3"}, ResourceObjects: []ResourceObject{obj}}
+
+	result := DiffReports(a, b, nil)
+	if result.SchemaVersion != DiffSchemaVersion {
+		t.Errorf("Got schema version %s, expected %s", result.SchemaVersion, DiffSchemaVersion)
+	}
+
+	if len(result.Differences) != 2 {
+		t.Fatalf("Got %v, expected 2 differences", result.Differences)
+	}
+
+	server := result.Differences[0]
+	if server.Kind != ChangeModified || server.Category != CategoryServer || server.Severity != SeverityWarning {
+		t.Errorf("Got %+v, expected a modified server difference", server)
+	}
+
+	added := result.Differences[1]
+	if added.Kind != ChangeAdded || added.Category != CategoryResourceObject || added.Severity != SeverityCritical {
+		t.Errorf("Got %+v, expected an added resource object", added)
+	}
+
+	if added.ResourceObject == nil || added.ResourceObject.Name != obj.Name || added.ResourceObject.Content != nil {
+		t.Errorf("Got %+v, expected the identity of %s without content", added.ResourceObject, obj)
+	}
+}
+
+func TestDiffReportsUnknown(t *testing.T) {
+	a := Report{
+		Resources: []Resource{{GroupVersion: "metrics.k8s.io/v1beta1", Name: "pods"}},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "x1"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "kube-system", Name: "x2"},
+		},
+	}
+	b := Report{
+		Errors: []RetrievalError{
+			{GroupVersion: "metrics.k8s.io/v1beta1", Message: "service unavailable"},
+			{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Message: "forbidden"},
+		},
+	}
+
+	result := DiffReports(a, b, nil)
+	exp := []string{
+		`Element: Resource metrics.k8s.io/v1beta1 /pods, A: exists, B: unknown`,
+		`Element: ResourceObject v1 configmaps/kube-system/x1, A: exists, B: unknown`,
+		`Element: ResourceObject v1 secrets/kube-system/x2, A: exists, B: does not exist`,
+	}
+	compare(result.Differences, exp, t)
+
+	if result.Changes[ChangeUnknown] != 2 || result.Changes[ChangeRemoved] != 1 || result.Changes[ChangeSchema] != 0 {
+		t.Errorf("Got %v, expected 2 unknown and 1 removed", result.Changes)
+	}
+}
+
+func TestDiffReportsVersionRemoved(t *testing.T) {
+	a := Report{
+		Resources: []Resource{
+			{GroupVersion: "apps/v1", Name: "deployments"},
+			{GroupVersion: "apps/v1beta2", Name: "deployments"},
+			{GroupVersion: "extensions/v1beta1", Name: "deployments"},
+		},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "apps/v1", Resource: "deployments", Namespace: "kube-system", Name: "coredns", Hash: "sha256:1"},
+			{GroupVersion: "apps/v1beta2", Resource: "deployments", Namespace: "kube-system", Name: "coredns", Hash: "sha256:1"},
+			{GroupVersion: "extensions/v1beta1", Resource: "deployments", Namespace: "kube-system", Name: "tiller"},
+		},
+	}
+	b := Report{
+		Resources: []Resource{
+			{GroupVersion: "apps/v1", Name: "deployments"},
+		},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "apps/v1", Resource: "deployments", Namespace: "kube-system", Name: "coredns", Hash: "sha256:2"},
+			{GroupVersion: "apps/v1", Resource: "deployments", Namespace: "kube-system", Name: "tiller"},
+		},
+	}
+
+	// The objects of another group are not moved and the modification of the
+	// object in the served version is reported once
+	result := DiffReports(a, b, nil)
+	exp := []string{
+		`Element: Resource apps/v1beta2 /deployments, A: exists, B: does not exist`,
+		`Element: Resource extensions/v1beta1 /deployments, A: exists, B: does not exist`,
+		`Element: ResourceObject apps v1 deployments kube-system coredns.Content, A: sha256:1, B: sha256:2`,
+		`Element: ResourceObject apps/v1 deployments/kube-system/tiller, A: does not exist, B: exists`,
+		`Element: ResourceObject extensions/v1beta1 deployments/kube-system/tiller, A: exists, B: does not exist`,
+	}
+	compare(result.Differences, exp, t)
+}
+
+func TestDiffReportsVersionMoved(t *testing.T) {
+	a := Report{
+		Resources: []Resource{{GroupVersion: "apps/v1beta2", Name: "deployments"}},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "apps/v1beta2", Resource: "deployments", Namespace: "kube-system", Name: "coredns", Hash: "sha256:1"},
+			{GroupVersion: "apps/v1beta2", Resource: "deployments", Namespace: "kube-system", Name: "dns", Hash: "sha256:1"},
+		},
+	}
+	b := Report{
+		Resources: []Resource{{GroupVersion: "apps/v1", Name: "deployments"}},
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "apps/v1", Resource: "deployments", Namespace: "kube-system", Name: "coredns", Hash: "sha256:1"},
+			{GroupVersion: "apps/v1", Resource: "deployments", Namespace: "kube-system", Name: "dns", Hash: "sha256:2"},
+		},
+	}
+
+	result := DiffReports(a, b, nil)
+	exp := []string{
+		`Element: Resource apps/v1 /deployments, A: does not exist, B: exists`,
+		`Element: Resource apps/v1beta2 /deployments, A: exists, B: does not exist`,
+		`Element: ResourceObject apps v1 deployments kube-system dns.Content, A: sha256:1, B: sha256:2`,
+	}
+	compare(result.Differences, exp, t)
+
+	if d := result.Differences[2]; d.Kind != ChangeModified || d.ResourceObject == nil || d.ResourceObject.GroupVersion != "apps/v1" {
+		t.Errorf("Got %+v, expected the modification of the object in apps/v1", d)
+	}
+	if result.Changes[ChangeModified] != 1 || result.Changes[ChangeAdded] != 0 || result.Changes[ChangeRemoved] != 0 {
+		t.Errorf("Got %v, expected one modification", result.Changes)
+	}
+}
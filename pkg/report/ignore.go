@@ -0,0 +1,169 @@
+package report
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Ignore defines the differences which are expected and should not be
+// reported, e.g. rotating objects
+type Ignore struct {
+	Rules []IgnoreRule
+}
+
+// IgnoreRule matches differences by the identity of the changed element.
+// Patterns are globs, or regular expressions if enclosed in slashes e.g.
+// '/^kube-.*$/'. Empty patterns match everything.
+//
+// Rules with an Element pattern only match the report elements e.g. ScanStart,
+// Server.Version, all other rules only match resources and resource objects.
+// Rules defining a Namespace or Name only match resource objects.
+type IgnoreRule struct {
+	Description string   `yaml:",omitempty" json:",omitempty"`
+	Element     string   `yaml:",omitempty" json:",omitempty"`
+	Group       string   `yaml:",omitempty" json:",omitempty"`
+	Version     string   `yaml:",omitempty" json:",omitempty"`
+	Resource    string   `yaml:",omitempty" json:",omitempty"`
+	Namespace   string   `yaml:",omitempty" json:",omitempty"`
+	Name        string   `yaml:",omitempty" json:",omitempty"`
+	Changes     []string `yaml:",omitempty" json:",omitempty"` // added|removed|modified|recreated|new-field-manager, empty for all
+
+	matchers []matcher
+}
+
+// IgnoreCount defines how many differences a rule has ignored
+type IgnoreCount struct {
+	Rule  IgnoreRule
+	Count int
+}
+
+// matcher matches a single value against a pattern
+type matcher func(string) bool
+
+// Compile validates and prepares all rules, it must be called before matching
+func (i *Ignore) Compile() error {
+	for r := range i.Rules {
+		if err := i.Rules[r].compile(); err != nil {
+			return fmt.Errorf("ignore rule %d: %s", r+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *IgnoreRule) compile() error {
+	for _, c := range r.Changes {
+		switch c {
+		case ChangeAdded, ChangeRemoved, ChangeModified, ChangeRecreated, ChangeNewManager:
+		default:
+			return fmt.Errorf("unknown change type %s", c)
+		}
+	}
+
+	r.matchers = []matcher{}
+	for _, pattern := range []string{r.Element, r.Group, r.Version, r.Resource, r.Namespace, r.Name} {
+		m, err := newMatcher(pattern)
+		if err != nil {
+			return err
+		}
+		r.matchers = append(r.matchers, m)
+	}
+
+	return nil
+}
+
+func newMatcher(pattern string) (matcher, error) {
+	if pattern == "" {
+		return func(string) bool { return true }, nil
+	}
+
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	// Check the glob syntax upfront, so that matching can not fail
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %s", pattern, err)
+	}
+
+	return func(s string) bool {
+		ok, _ := path.Match(pattern, s)
+		return ok
+	}, nil
+}
+
+func (r IgnoreRule) matchesChange(change string) bool {
+	if len(r.Changes) == 0 {
+		return true
+	}
+
+	for _, c := range r.Changes {
+		if c == change {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchElement returns the index of the first rule matching the report
+// element or -1
+func (i *Ignore) MatchElement(element string, change string) int {
+	if i == nil {
+		return -1
+	}
+
+	for n, r := range i.Rules {
+		if r.Element != "" && r.matchesChange(change) && r.matchers[0](element) {
+			return n
+		}
+	}
+
+	return -1
+}
+
+// Match returns the index of the first rule matching the Resource or
+// ResourceObject k or -1
+func (i *Ignore) Match(k Keyer, change string) int {
+	if i == nil {
+		return -1
+	}
+
+	var groupversion, resource, namespace, name string
+	object := false
+
+	switch t := k.(type) {
+	case Resource:
+		groupversion, resource = t.GroupVersion, t.Name
+	case ResourceObject:
+		groupversion, resource, namespace, name = t.GroupVersion, t.Resource, t.Namespace, t.Name
+		object = true
+	default:
+		return -1
+	}
+
+	group, version := SplitGroupVersionSafe(groupversion)
+
+	for n, r := range i.Rules {
+		if r.Element != "" || !r.matchesChange(change) {
+			continue
+		}
+
+		if !object && (r.Namespace != "" || r.Name != "") {
+			continue
+		}
+
+		if r.matchers[1](group) && r.matchers[2](version) && r.matchers[3](resource) &&
+			r.matchers[4](namespace) && r.matchers[5](name) {
+			return n
+		}
+	}
+
+	return -1
+}
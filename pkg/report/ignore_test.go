@@ -0,0 +1,79 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func newIgnore(t *testing.T, rules ...IgnoreRule) *Ignore {
+	ignore := &Ignore{Rules: rules}
+	if err := ignore.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ignore
+}
+
+func TestIgnoreCompileInvalid(t *testing.T) {
+	for _, r := range []IgnoreRule{{Name: "/(/"}, {Name: "[a"}, {Changes: []string{"renamed"}}} {
+		ignore := &Ignore{Rules: []IgnoreRule{r}}
+		if err := ignore.Compile(); err == nil {
+			t.Errorf("Expected an error for %+v", r)
+		}
+	}
+}
+
+func TestIgnoreMatch(t *testing.T) {
+	ignore := newIgnore(t,
+		IgnoreRule{Element: "Scan*"},
+		IgnoreRule{Version: "v1", Resource: "secrets", Name: "*-token-*"},
+		IgnoreRule{Group: "/^(|apps)$/", Resource: "configmaps", Changes: []string{ChangeModified}},
+	)
+
+	tests := []struct {
+		k      Keyer
+		change string
+		exp    int
+	}{
+		{ResourceObject{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "default-token-wsq94"}, ChangeAdded, 1},
+		{ResourceObject{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "default"}, ChangeAdded, -1},
+		{ResourceObject{GroupVersion: "v1", Resource: "configmaps", Name: "x1"}, ChangeModified, 2},
+		{ResourceObject{GroupVersion: "v1", Resource: "configmaps", Name: "x1"}, ChangeAdded, -1},
+		{Resource{GroupVersion: "v1", Name: "secrets"}, ChangeAdded, -1},
+		{Resource{GroupVersion: "v1", Name: "configmaps"}, ChangeModified, 2},
+	}
+
+	for _, test := range tests {
+		if n := ignore.Match(test.k, test.change); n != test.exp {
+			t.Errorf("Got rule %d for %s %s, expected %d", n, test.k, test.change, test.exp)
+		}
+	}
+
+	if n := ignore.MatchElement("ScanEnd", ChangeModified); n != 0 {
+		t.Errorf("Got rule %d for ScanEnd, expected 0", n)
+	}
+}
+
+func TestDiffReportsIgnore(t *testing.T) {
+	a := Report{
+		ScanStart:       time.Unix(0, 0),
+		ResourceObjects: []ResourceObject{{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "default-token-abcde"}},
+	}
+	b := Report{
+		ScanStart: time.Unix(1, 0),
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "default-token-fghij"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "shouldnotbehere"},
+		},
+	}
+
+	ignore := newIgnore(t, IgnoreRule{Element: "Scan*"}, IgnoreRule{Resource: "secrets", Name: "*-token-*"})
+	result := DiffReports(a, b, ignore)
+	exp := []string{`Element: ResourceObject v1 secrets/default/shouldnotbehere, A: does not exist, B: exists`}
+	compare(result.Differences, exp, t)
+
+	counts := result.Ignored
+	if len(counts) != 2 || counts[0].Count != 1 || counts[1].Count != 2 {
+		t.Errorf("Got counts %+v, expected 1 and 2", counts)
+	}
+}
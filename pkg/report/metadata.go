@@ -0,0 +1,117 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ObjectMetadata is the metadata of a resource object which is not part of
+// its content, e.g. its identity in the cluster and who manages it
+type ObjectMetadata struct {
+	UID               string
+	CreationTimestamp time.Time
+	Generation        int64             `yaml:",omitempty" json:",omitempty"`
+	Labels            map[string]string `yaml:",omitempty" json:",omitempty"` // only the selected labels
+	Annotations       map[string]string `yaml:",omitempty" json:",omitempty"` // only the selected annotations
+	Owners            []OwnerReference  `yaml:",omitempty" json:",omitempty"`
+	Managers          []string          `yaml:",omitempty" json:",omitempty"` // sorted field managers of the managedFields
+}
+
+// OwnerReference references the owner of a resource object
+type OwnerReference struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Controller bool `yaml:",omitempty" json:",omitempty"`
+}
+
+func (o OwnerReference) String() string {
+	ret := fmt.Sprintf("%s %s/%s", o.APIVersion, o.Kind, o.Name)
+	if o.Controller {
+		ret += " (controller)"
+	}
+
+	return ret
+}
+
+// Compare compares the metadata a of an object to its metadata b in a later
+// snapshot. A changed UID is reported as recreated and every field manager
+// of b, which did not manage the object in a, as new field manager.
+func (a ObjectMetadata) Compare(b ObjectMetadata) []DiffReport {
+	ret := []DiffReport{}
+
+	recreated := a.UID != "" && b.UID != "" && a.UID != b.UID
+	if recreated {
+		ret = append(ret, DiffReport{Element: "Metadata.UID", A: a.UID, B: b.UID, Kind: ChangeRecreated})
+	} else if a.Generation != 0 && b.Generation != 0 && a.Generation != b.Generation {
+		// The generation of a recreated object starts again
+		ret = append(ret, DiffReport{Element: "Metadata.Generation", A: fmt.Sprint(a.Generation), B: fmt.Sprint(b.Generation)})
+	}
+
+	ret = append(ret, mapDiff("Metadata.Labels", a.Labels, b.Labels)...)
+	ret = append(ret, mapDiff("Metadata.Annotations", a.Annotations, b.Annotations)...)
+
+	aowners := ownersString(a.Owners)
+	bowners := ownersString(b.Owners)
+	if aowners != bowners {
+		ret = append(ret, DiffReport{Element: "Metadata.Owners", A: aowners, B: bowners})
+	}
+
+	// Managers are only recorded if the API server tracks managed fields
+	if len(a.Managers) != 0 {
+		known := map[string]bool{}
+		for _, m := range a.Managers {
+			known[m] = true
+		}
+
+		for _, m := range b.Managers {
+			if !known[m] {
+				ret = append(ret, DiffReport{Element: "Metadata.Managers." + m, A: "does not exist", B: m, Kind: ChangeNewManager})
+			}
+		}
+	}
+
+	return ret
+}
+
+// mapDiff returns one DiffReport for every differing key of a and b
+func mapDiff(element string, a, b map[string]string) []DiffReport {
+	keys := []string{}
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	ret := []DiffReport{}
+	for _, k := range keys {
+		av, aok := a[k]
+		bv, bok := b[k]
+
+		switch {
+		case !aok:
+			ret = append(ret, DiffReport{Element: element + "." + k, A: "does not exist", B: bv})
+		case !bok:
+			ret = append(ret, DiffReport{Element: element + "." + k, A: av, B: "does not exist"})
+		case av != bv:
+			ret = append(ret, DiffReport{Element: element + "." + k, A: av, B: bv})
+		}
+	}
+
+	return ret
+}
+
+func ownersString(owners []OwnerReference) string {
+	s := make([]string, len(owners))
+	for i, o := range owners {
+		s[i] = o.String()
+	}
+
+	return strings.Join(s, ", ")
+}
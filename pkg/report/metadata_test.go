@@ -0,0 +1,75 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func metadataObject(uid string, generation int64, managers ...string) ResourceObject {
+	return ResourceObject{
+		GroupVersion: "rbac.authorization.k8s.io/v1",
+		Resource:     "clusterrolebindings",
+		Name:         "admin",
+		Metadata: &ObjectMetadata{
+			UID:               uid,
+			CreationTimestamp: time.Unix(0, 0),
+			Generation:        generation,
+			Labels:            map[string]string{"app.kubernetes.io/managed-by": "helm"},
+			Managers:          managers,
+		},
+	}
+}
+
+func TestObjectMetadataCompare(t *testing.T) {
+	a := metadataObject("1c9e", 1, "helm")
+	b := metadataObject("1c9e", 2, "helm", "kubectl-edit")
+	b.Metadata.Labels = nil
+	b.Metadata.Owners = []OwnerReference{{APIVersion: "v1", Kind: "Namespace", Name: "x", Controller: true}}
+
+	exp := []string{
+		`Element: Metadata.Generation, A: 1, B: 2`,
+		`Element: Metadata.Labels.app.kubernetes.io/managed-by, A: helm, B: does not exist`,
+		`Element: Metadata.Owners, A: , B: v1 Namespace/x (controller)`,
+		`Element: Metadata.Managers.kubectl-edit, A: does not exist, B: kubectl-edit`,
+	}
+	compare(a.Compare(b), exp, t)
+}
+
+func TestObjectMetadataWithoutManagers(t *testing.T) {
+	// Managers which were not tracked before are not new
+	a := metadataObject("1c9e", 1)
+	b := metadataObject("1c9e", 1, "kube-apiserver")
+	compare(a.Compare(b), []string{}, t)
+}
+
+func TestDiffReportsRecreated(t *testing.T) {
+	a := Report{ResourceObjects: []ResourceObject{metadataObject("1c9e", 3, "helm")}}
+	b := Report{ResourceObjects: []ResourceObject{metadataObject("7f3a", 1, "helm", "kubectl-create")}}
+
+	result := DiffReports(a, b, nil)
+	exp := map[string]int{ChangeRecreated: 1, ChangeNewManager: 1}
+	if !reflect.DeepEqual(result.Changes, exp) {
+		t.Errorf("Got %v, expected %v", result.Changes, exp)
+	}
+
+	if len(result.Differences) != 2 {
+		t.Fatalf("Got %v, expected 2 differences", result.Differences)
+	}
+
+	recreated := result.Differences[0]
+	if recreated.Kind != ChangeRecreated || recreated.B != "7f3a" || recreated.ResourceObject == nil || recreated.ResourceObject.Metadata != nil {
+		t.Errorf("Got %+v, expected a recreated resource object without metadata", recreated)
+	}
+
+	// The new field managers can be ignored separately
+	ignore := &Ignore{Rules: []IgnoreRule{{Resource: "clusterrolebindings", Changes: []string{ChangeNewManager}}}}
+	if err := ignore.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	result = DiffReports(a, b, ignore)
+	if len(result.Differences) != 1 || result.Differences[0].Kind != ChangeRecreated || result.Ignored[0].Count != 1 {
+		t.Errorf("Got %v ignoring %v, expected only the recreated difference", result.Differences, result.Ignored)
+	}
+}
@@ -0,0 +1,243 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy declares the expected state of a cluster with rules, which allow or
+// deny resource objects, instead of a full baseline
+type Policy struct {
+	Rules []PolicyRule
+}
+
+// PolicyRule selects resource objects by their identity and, if the content
+// has been recorded, by the values of their fields. A selected object violates
+// the rule if its name matches one of the Deny patterns, or if Allow is set and
+// its name matches none of the Allow patterns.
+//
+// Patterns are globs, or regular expressions if enclosed in slashes e.g.
+// '/^(kube-|appl-|default$)/'. Empty patterns match everything.
+type PolicyRule struct {
+	Description string `yaml:",omitempty" json:",omitempty"`
+	Group       string `yaml:",omitempty" json:",omitempty"`
+	Version     string `yaml:",omitempty" json:",omitempty"`
+	Resource    string `yaml:",omitempty" json:",omitempty"`
+	Namespace   string `yaml:",omitempty" json:",omitempty"`
+	// Fields selects the objects whose content has a value matching the
+	// pattern at every JSON path in dot notation e.g. roleRef.name
+	Fields   map[string]string `yaml:",omitempty" json:",omitempty"`
+	Allow    []string          `yaml:",omitempty" json:",omitempty"`
+	Deny     []string          `yaml:",omitempty" json:",omitempty"`
+	Severity string            `yaml:",omitempty" json:",omitempty"` // info|warning|critical, empty for critical
+
+	matchers []matcher
+	fields   map[string]matcher
+	allow    []matcher
+	deny     []matcher
+}
+
+// Compile validates and prepares all rules, it must be called before checking
+func (p *Policy) Compile() error {
+	for r := range p.Rules {
+		if err := p.Rules[r].compile(); err != nil {
+			return fmt.Errorf("policy rule %d: %s", r+1, err)
+		}
+	}
+
+	return nil
+}
+
+// NeedsContent returns true if a rule selects objects by their content
+func (p *Policy) NeedsContent() bool {
+	for _, r := range p.Rules {
+		if len(r.Fields) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *PolicyRule) compile() error {
+	if len(r.Allow) == 0 && len(r.Deny) == 0 {
+		return fmt.Errorf("either allow or deny is required")
+	}
+
+	switch r.Severity {
+	case "", SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("unknown severity %s", r.Severity)
+	}
+
+	var err error
+	if r.matchers, err = newMatchers([]string{r.Group, r.Version, r.Resource, r.Namespace}); err != nil {
+		return err
+	}
+	if r.allow, err = newMatchers(r.Allow); err != nil {
+		return err
+	}
+	if r.deny, err = newMatchers(r.Deny); err != nil {
+		return err
+	}
+
+	r.fields = map[string]matcher{}
+	for path, pattern := range r.Fields {
+		if r.fields[path], err = newMatcher(pattern); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newMatchers(patterns []string) ([]matcher, error) {
+	ret := []matcher{}
+	for _, pattern := range patterns {
+		m, err := newMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+
+	return ret, nil
+}
+
+// selects returns true if the rule applies to objects of the resource in the
+// namespace
+func (r PolicyRule) selects(groupversion, resource, namespace string) bool {
+	group, version := SplitGroupVersionSafe(groupversion)
+
+	return r.matchers[0](group) && r.matchers[1](version) && r.matchers[2](resource) && r.matchers[3](namespace)
+}
+
+// covers returns true if the retrieval error e may hide objects which are
+// selected by the rule
+func (r PolicyRule) covers(e RetrievalError) bool {
+	group, version := SplitGroupVersionSafe(e.GroupVersion)
+
+	return r.matchers[0](group) && r.matchers[1](version) &&
+		(e.Resource == "" || r.matchers[2](e.Resource)) && (e.Namespace == "" || r.matchers[3](e.Namespace))
+}
+
+// violates returns true if o is selected by the rule and not allowed
+func (r PolicyRule) violates(o ResourceObject) bool {
+	if !r.selects(o.GroupVersion, o.Resource, o.Namespace) {
+		return false
+	}
+
+	for path, m := range r.fields {
+		value, ok := fieldValue(o.Content, path)
+		if !ok || !m(value) {
+			return false
+		}
+	}
+
+	if anyMatch(r.deny, o.Name) {
+		return true
+	}
+
+	return len(r.allow) != 0 && !anyMatch(r.allow, o.Name)
+}
+
+func anyMatch(matchers []matcher, s string) bool {
+	for _, m := range matchers {
+		if m(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldValue returns the value at the JSON path in dot notation of the
+// content, values which are no strings are returned in their JSON encoding
+func fieldValue(content map[string]interface{}, path string) (string, bool) {
+	// The maps of yaml snapshots have no string keys
+	v := normalizeValue(content)
+	for _, field := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+
+		if v, ok = m[field]; !ok {
+			return "", false
+		}
+	}
+
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+
+	return encodeValue(v), true
+}
+
+// description returns the rule number n and its description for reports
+func (r PolicyRule) description(n int) string {
+	if r.Description == "" {
+		return fmt.Sprintf("rule %d", n+1)
+	}
+
+	return fmt.Sprintf("rule %d (%s)", n+1, r.Description)
+}
+
+// Check evaluates the resource objects of rep against the compiled policy.
+// Every object violating a rule is reported as added, as it should not exist.
+// Resources which could not be listed and might hold violating objects are
+// reported as unknown. The result has the format of DiffReports.
+func (p *Policy) Check(rep Report) DiffResult {
+	ret := []DiffReport{}
+	changes := map[string]int{}
+
+	for _, o := range rep.ResourceObjects {
+		violated := false
+		for n, r := range p.Rules {
+			if !r.violates(o) {
+				continue
+			}
+
+			severity := r.Severity
+			if severity == "" {
+				severity = SeverityCritical
+			}
+
+			d := []DiffReport{{Element: o.String(), A: "denied by " + r.description(n), B: "exists", Category: CategoryResourceObject, Severity: severity}}
+			identify(d, o, ChangeAdded)
+			AnnotateDiffReports(d, "ResourceObject ")
+			ret = append(ret, d...)
+			violated = true
+		}
+
+		if violated {
+			changes[ChangeAdded]++
+		}
+	}
+
+	for _, e := range rep.Errors {
+		for n, r := range p.Rules {
+			if !r.covers(e) {
+				continue
+			}
+
+			ret = append(ret, DiffReport{
+				Element:  fmt.Sprintf("ResourceObject %s %s/%s", e.GroupVersion, e.Resource, e.Namespace),
+				A:        "not verified by " + r.description(n),
+				B:        ChangeUnknown,
+				Kind:     ChangeUnknown,
+				Category: CategoryResourceObject,
+				Severity: SeverityWarning,
+			})
+			changes[ChangeUnknown]++
+			break
+		}
+	}
+
+	return DiffResult{
+		SchemaVersion: DiffSchemaVersion,
+		Differences:   ret,
+		Ignored:       []IgnoreCount{},
+		Changes:       changes,
+	}
+}
@@ -0,0 +1,73 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{Rules: []PolicyRule{
+		{Description: "Known service accounts", Version: "v1", Resource: "serviceaccounts", Namespace: "kube-system", Allow: []string{"default", "coredns", "*-controller"}},
+		{Description: "Namespaces", Resource: "namespaces", Allow: []string{"/^(kube-|appl-|default$)/"}},
+		{Description: "cluster-admin", Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings", Fields: map[string]string{"roleRef.name": "cluster-admin"}, Allow: []string{"cluster-admin"}},
+		{Resource: "secrets", Deny: []string{"*-token-*"}, Severity: SeverityWarning},
+	}}
+	if err := policy.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	binding := func(name, role string) ResourceObject {
+		return ResourceObject{GroupVersion: "rbac.authorization.k8s.io/v1", Resource: "clusterrolebindings", Name: name,
+			Content: map[string]interface{}{"roleRef": map[interface{}]interface{}{"kind": "ClusterRole", "name": role}}}
+	}
+
+	rep := Report{
+		ResourceObjects: []ResourceObject{
+			{GroupVersion: "v1", Resource: "namespaces", Name: "appl-x"},
+			{GroupVersion: "v1", Resource: "namespaces", Name: "shouldnotbehere"},
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "default", Name: "shouldnotbehere"},
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "kube-system", Name: "shouldnotbehere"},
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "kube-system", Name: "job-controller"},
+			{GroupVersion: "v1", Resource: "secrets", Namespace: "kube-system", Name: "shouldnotbehere-token-rwmcl"},
+			binding("cluster-admin", "cluster-admin"),
+			binding("backdoor", "cluster-admin"),
+			binding("view", "view"),
+		},
+		Errors: []RetrievalError{
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "kube-public", Message: "forbidden"},
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "kube-system", Message: "forbidden"},
+		},
+	}
+
+	result := policy.Check(rep)
+	exp := []string{
+		`Element: ResourceObject v1 namespaces//shouldnotbehere, A: denied by rule 2 (Namespaces), B: exists`,
+		`Element: ResourceObject v1 serviceaccounts/kube-system/shouldnotbehere, A: denied by rule 1 (Known service accounts), B: exists`,
+		`Element: ResourceObject v1 secrets/kube-system/shouldnotbehere-token-rwmcl, A: denied by rule 4, B: exists`,
+		`Element: ResourceObject rbac.authorization.k8s.io/v1 clusterrolebindings//backdoor, A: denied by rule 3 (cluster-admin), B: exists`,
+		`Element: ResourceObject v1 serviceaccounts/kube-system, A: not verified by rule 1 (Known service accounts), B: unknown`,
+	}
+	compare(result.Differences, exp, t)
+
+	if changes := map[string]int{ChangeAdded: 4, ChangeUnknown: 1}; !reflect.DeepEqual(result.Changes, changes) {
+		t.Errorf("Got %v, expected %v", result.Changes, changes)
+	}
+
+	if d := result.Differences[2]; d.Kind != ChangeAdded || d.Severity != SeverityWarning || d.ResourceObject == nil || d.ResourceObject.Name != "shouldnotbehere-token-rwmcl" {
+		t.Errorf("Got %+v, expected an added secret with warning severity", d)
+	}
+}
+
+func TestPolicyCompile(t *testing.T) {
+	for _, r := range []PolicyRule{
+		{Resource: "secrets"},
+		{Resource: "secrets", Deny: []string{"[a-"}},
+		{Resource: "secrets", Deny: []string{"*"}, Severity: "high"},
+		{Resource: "secrets", Allow: []string{"x"}, Fields: map[string]string{"type": "/(/"}},
+	} {
+		policy := &Policy{Rules: []PolicyRule{r}}
+		if err := policy.Compile(); err == nil {
+			t.Errorf("Expected an error for rule %+v", r)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package report
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -13,12 +15,70 @@ type Report struct {
 	Resources       []Resource
 	ResourceObjects []ResourceObject
 	Configuration   Configuration
+	Timings         []Timing         `yaml:",omitempty" json:",omitempty"`
+	Errors          []RetrievalError `yaml:",omitempty" json:",omitempty"`
+	// Audit records the differences accepted into a baseline
+	Audit []Acceptance `yaml:",omitempty" json:",omitempty"`
 }
 
 // Configuration defines the scanning configuration used
 type Configuration struct {
 	Namespaces      []string
 	KubewireVersion string
+	ContentHash     bool `yaml:",omitempty" json:",omitempty"`
+	Content         bool `yaml:",omitempty" json:",omitempty"`
+	// Metadata defines that the object metadata has been recorded with the
+	// labels and annotations matching the glob patterns of Labels and
+	// Annotations
+	Metadata    bool     `yaml:",omitempty" json:",omitempty"`
+	Labels      []string `yaml:",omitempty" json:",omitempty"`
+	Annotations []string `yaml:",omitempty" json:",omitempty"`
+	// PreferredVersions defines that only the preferred version of every API
+	// group has been scanned
+	PreferredVersions bool `yaml:",omitempty" json:",omitempty"`
+	// Context defines the kubeconfig context of the scanned cluster, empty for
+	// the current context
+	Context string `yaml:",omitempty" json:",omitempty"`
+	// Identity and Groups define the user kubewire has authenticated or
+	// impersonated as, empty if it is not known
+	Identity string   `yaml:",omitempty" json:",omitempty"`
+	Groups   []string `yaml:",omitempty" json:",omitempty"`
+}
+
+// RetrievalError defines an API group which could not be discovered or a
+// resource which could not be listed, so the state of their objects is unknown
+type RetrievalError struct {
+	GroupVersion string
+	Resource     string `yaml:",omitempty" json:",omitempty"` // empty if the discovery failed
+	Namespace    string `yaml:",omitempty" json:",omitempty"`
+	Message      string
+}
+
+// String returns a human readable representation of the error
+func (e RetrievalError) String() string {
+	return fmt.Sprintf("%s %s/%s: %s", e.GroupVersion, e.Resource, e.Namespace, e.Message)
+}
+
+// Covers returns true if the error affects the resource object o
+func (e RetrievalError) Covers(o ResourceObject) bool {
+	return e.GroupVersion == o.GroupVersion &&
+		(e.Resource == "" || e.Resource == o.Resource) &&
+		(e.Namespace == "" || e.Namespace == o.Namespace)
+}
+
+// CoversResource returns true if the error affects the discovery of the
+// resource r
+func (e RetrievalError) CoversResource(r Resource) bool {
+	return e.GroupVersion == r.GroupVersion && e.Resource == ""
+}
+
+// Timing defines how long it took to list the objects of a resource
+type Timing struct {
+	GroupVersion string
+	Resource     string
+	Namespace    string `yaml:",omitempty" json:",omitempty"`
+	Duration     time.Duration
+	Objects      int
 }
 
 // Server holds the information about the remote kubernetes instance
@@ -34,6 +94,8 @@ type Resource struct {
 	Kind         string
 	Namespaced   bool
 	Listable     bool
+	Verbs        []string
+	Versions     []string `yaml:",omitempty" json:",omitempty"` // all versions of the group serving this resource
 }
 
 // String returns a human readable string for this resource
@@ -80,6 +142,24 @@ func (a Resource) Compare(b interface{}) []DiffReport {
 		ret = append(ret, DiffReport{Element: "Namespaced", A: ans, B: bns})
 	}
 
+	// Snapshots taken before verbs were recorded have none, so only compare
+	// them if both sides know about them
+	if len(a.Verbs) != 0 && len(bres.Verbs) != 0 {
+		averbs := verbsString(a.Verbs)
+		bverbs := verbsString(bres.Verbs)
+		if averbs != bverbs {
+			ret = append(ret, DiffReport{Element: "Verbs", A: averbs, B: bverbs})
+		}
+	}
+
+	if len(a.Versions) != 0 && len(bres.Versions) != 0 {
+		aversions := fmt.Sprintf("%v", a.Versions)
+		bversions := fmt.Sprintf("%v", bres.Versions)
+		if aversions != bversions {
+			ret = append(ret, DiffReport{Element: "Versions", A: aversions, B: bversions})
+		}
+	}
+
 	if len(ret) == 0 {
 		return nil
 	}
@@ -87,12 +167,50 @@ func (a Resource) Compare(b interface{}) []DiffReport {
 	return ret
 }
 
+// HasVerb returns true if the resource supports the verb
+func (a Resource) HasVerb(verb string) bool {
+	for _, v := range a.Verbs {
+		if v == verb {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verbsString returns a sorted, human readable representation of verbs
+func verbsString(verbs []string) string {
+	sorted := make([]string, len(verbs))
+	copy(sorted, verbs)
+	sort.Strings(sorted)
+
+	return "[" + strings.Join(sorted, " ") + "]"
+}
+
 // ResourceObject represent a persistent entity in the system
 type ResourceObject struct {
 	GroupVersion string
 	Resource     string // references Resource.Name
 	Namespace    string
 	Name         string
+	Hash         string                 `yaml:",omitempty" json:",omitempty"` // fingerprint of the normalized content
+	Content      map[string]interface{} `yaml:",omitempty" json:",omitempty"` // normalized content with redacted Secret data
+	Metadata     *ObjectMetadata        `yaml:",omitempty" json:",omitempty"`
+}
+
+// UnmarshalYAML decodes the content with string keys like in json, as
+// snapshots read from yaml could not be encoded as json otherwise
+func (a *ResourceObject) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ResourceObject
+	if err := unmarshal((*plain)(a)); err != nil {
+		return err
+	}
+
+	if a.Content != nil {
+		a.Content = normalizeValue(a.Content).(map[string]interface{})
+	}
+
+	return nil
 }
 
 // Key returns a unique identifier for the ResourceObject which can be
@@ -135,6 +253,24 @@ func (a ResourceObject) Compare(b interface{}) []DiffReport {
 		ret = append(ret, DiffReport{Element: "GroupVersion", A: a.GroupVersion, B: bres.GroupVersion})
 	}
 
+	// The content can only be compared if both snapshots recorded it, field
+	// level differences are preferred over the fingerprint
+	var fields []DiffReport
+	if a.Content != nil && bres.Content != nil {
+		fields = ContentDiff(a.Content, bres.Content)
+	}
+
+	if len(fields) != 0 {
+		ret = append(ret, fields...)
+	} else if a.Hash != "" && bres.Hash != "" && a.Hash != bres.Hash {
+		ret = append(ret, DiffReport{Element: "Content", A: a.Hash, B: bres.Hash})
+	}
+
+	// The metadata is only compared if both snapshots recorded it
+	if a.Metadata != nil && bres.Metadata != nil {
+		ret = append(ret, a.Metadata.Compare(*bres.Metadata)...)
+	}
+
 	if len(ret) == 0 {
 		return nil
 	}
@@ -0,0 +1,98 @@
+package retrieval
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// volatileFields lists the fields which change without anybody modifying
+// the object and therefore are not part of the content fingerprint
+var volatileFields = [][]string{
+	{"metadata", "resourceVersion"},
+	{"metadata", "selfLink"},
+	{"metadata", "uid"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "generation"},
+	{"metadata", "managedFields"},
+	{"status"},
+}
+
+// Normalize returns a deep copy of the object content without volatile fields
+func Normalize(obj runtime.Unstructured) map[string]interface{} {
+	content := runtime.DeepCopyJSON(obj.UnstructuredContent())
+
+	for _, path := range volatileFields {
+		removeField(content, path)
+	}
+
+	return content
+}
+
+// Fingerprint returns a stable hash of the normalized object content
+func Fingerprint(obj runtime.Unstructured) (string, error) {
+	// encoding/json sorts map keys, so the encoding is deterministic
+	raw, err := json.Marshal(Normalize(obj))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(raw)), nil
+}
+
+func removeField(content map[string]interface{}, path []string) {
+	m := content
+	for _, field := range path[:len(path)-1] {
+		next, ok := m[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+
+	delete(m, path[len(path)-1])
+}
+
+// secretAnnotations lists the annotations of Secrets which may contain the
+// secret data
+var secretAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+}
+
+// Content returns the normalized object content, where the values of Secrets
+// are replaced by their hashes so that they do not end up in a snapshot
+func Content(obj runtime.Unstructured, resource report.Resource) map[string]interface{} {
+	content := Normalize(obj)
+
+	group, _ := report.SplitGroupVersionSafe(resource.GroupVersion)
+	if group != "" || resource.Name != "secrets" {
+		return content
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		if data, ok := content[field].(map[string]interface{}); ok {
+			for k, v := range data {
+				data[k] = redact(v)
+			}
+		}
+	}
+
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			for _, k := range secretAnnotations {
+				if v, ok := annotations[k]; ok {
+					annotations[k] = redact(v)
+				}
+			}
+		}
+	}
+
+	return content
+}
+
+func redact(v interface{}) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(fmt.Sprint(v))))
+}
@@ -0,0 +1,82 @@
+package retrieval
+
+import (
+	"testing"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newConfigMap(resourceVersion string, data string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":            "x1",
+			"namespace":       "kube-system",
+			"resourceVersion": resourceVersion,
+			"uid":             "b0b9d0a4-0f4c-11e9-ab14-d663bd873d93",
+		},
+		"data": map[string]interface{}{
+			"key": data,
+		},
+	}}
+}
+
+func TestFingerprintIgnoresVolatileFields(t *testing.T) {
+	a, err := Fingerprint(newConfigMap("1", "value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Fingerprint(newConfigMap("2", "value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a != b {
+		t.Errorf("Got %s and %s, expected equal fingerprints", a, b)
+	}
+}
+
+func TestFingerprintDetectsModification(t *testing.T) {
+	a, err := Fingerprint(newConfigMap("1", "value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Fingerprint(newConfigMap("1", "other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Errorf("Got %s for both, expected different fingerprints", a)
+	}
+}
+
+func TestNormalizeKeepsOriginal(t *testing.T) {
+	obj := newConfigMap("1", "value")
+	Normalize(obj)
+
+	if obj.GetResourceVersion() != "1" {
+		t.Errorf("Normalize modified the original object")
+	}
+}
+
+func TestContentRedactsSecrets(t *testing.T) {
+	obj := newConfigMap("1", "value")
+	obj.SetKind("Secret")
+
+	content := Content(obj, report.Resource{GroupVersion: "v1", Name: "secrets"})
+	data := content["data"].(map[string]interface{})
+	if data["key"] == "value" {
+		t.Errorf("Secret data has not been redacted")
+	}
+
+	content = Content(newConfigMap("1", "value"), report.Resource{GroupVersion: "v1", Name: "configmaps"})
+	data = content["data"].(map[string]interface{})
+	if data["key"] != "value" {
+		t.Errorf("Got %v, expected ConfigMap data to be kept", data["key"])
+	}
+}
@@ -0,0 +1,52 @@
+package retrieval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"k8s.io/client-go/discovery"
+)
+
+// PartialError is returned if some API groups could not be discovered or some
+// resources could not be listed. The results returned along with it are valid
+// for everything else.
+type PartialError struct {
+	Errors []report.RetrievalError
+}
+
+func (e *PartialError) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.String())
+	}
+
+	return fmt.Sprintf("retrieval failed partially: %s", strings.Join(msgs, "; "))
+}
+
+// IsPartialError returns true if err is a PartialError
+func IsPartialError(err error) bool {
+	_, ok := err.(*PartialError)
+	return ok
+}
+
+// discoveryErrors converts the failed groups of a discovery into
+// RetrievalErrors, other errors are returned unchanged
+func discoveryErrors(err error) ([]report.RetrievalError, error) {
+	failed, ok := err.(*discovery.ErrGroupDiscoveryFailed)
+	if !ok {
+		return nil, err
+	}
+
+	ret := []report.RetrievalError{}
+	for gv, e := range failed.Groups {
+		ret = append(ret, report.RetrievalError{GroupVersion: gv.String(), Message: e.Error()})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].GroupVersion < ret[j].GroupVersion
+	})
+
+	return ret, nil
+}
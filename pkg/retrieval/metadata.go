@@ -0,0 +1,94 @@
+package retrieval
+
+import (
+	"path"
+	"sort"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Metadata returns the metadata of obj with the labels and annotations whose
+// keys match one of the glob patterns of labels and annotations e.g.
+// app.kubernetes.io/*. Secret annotations of Secrets are redacted like in the
+// content.
+func Metadata(obj runtime.Unstructured, resource report.Resource, labels, annotations []string) (*report.ObjectMetadata, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &report.ObjectMetadata{
+		UID:               string(accessor.GetUID()),
+		CreationTimestamp: accessor.GetCreationTimestamp().UTC(),
+		Generation:        accessor.GetGeneration(),
+		Labels:            selectKeys(accessor.GetLabels(), labels),
+		Annotations:       selectKeys(accessor.GetAnnotations(), annotations),
+		Managers:          managers(obj.UnstructuredContent()),
+	}
+
+	group, _ := report.SplitGroupVersionSafe(resource.GroupVersion)
+	if group == "" && resource.Name == "secrets" {
+		for _, k := range secretAnnotations {
+			if v, ok := ret.Annotations[k]; ok {
+				ret.Annotations[k] = redact(v)
+			}
+		}
+	}
+
+	for _, o := range accessor.GetOwnerReferences() {
+		ret.Owners = append(ret.Owners, report.OwnerReference{
+			APIVersion: o.APIVersion,
+			Kind:       o.Kind,
+			Name:       o.Name,
+			Controller: o.Controller != nil && *o.Controller,
+		})
+	}
+
+	return ret, nil
+}
+
+// selectKeys returns the entries of m whose keys match one of the patterns,
+// nil if there are none
+func selectKeys(m map[string]string, patterns []string) map[string]string {
+	var ret map[string]string
+	for k, v := range m {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, k); ok {
+				if ret == nil {
+					ret = map[string]string{}
+				}
+				ret[k] = v
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// managers returns the sorted field managers of metadata.managedFields in
+// content. The API server only tracks them since Kubernetes 1.18.
+func managers(content map[string]interface{}) []string {
+	metadata, _ := content["metadata"].(map[string]interface{})
+	fields, _ := metadata["managedFields"].([]interface{})
+
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, f := range fields {
+		entry, _ := f.(map[string]interface{})
+		if m, ok := entry["manager"].(string); ok && m != "" && !seen[m] {
+			seen[m] = true
+			ret = append(ret, m)
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
@@ -0,0 +1,47 @@
+package retrieval
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+func TestMetadata(t *testing.T) {
+	obj := newConfigMap("1", "value")
+	obj.SetLabels(map[string]string{"app.kubernetes.io/name": "coredns", "pod-template-hash": "5c98db65d4"})
+	obj.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"})
+	obj.SetGeneration(2)
+	metadata := obj.Object["metadata"].(map[string]interface{})
+	metadata["managedFields"] = []interface{}{
+		map[string]interface{}{"manager": "kubectl-client-side-apply", "operation": "Update"},
+		map[string]interface{}{"manager": "kubectl-edit", "operation": "Update"},
+		map[string]interface{}{"manager": "kubectl-client-side-apply", "operation": "Apply"},
+	}
+
+	m, err := Metadata(obj, report.Resource{GroupVersion: "v1", Name: "configmaps"}, []string{"app.kubernetes.io/*"}, []string{"kubectl.kubernetes.io/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &report.ObjectMetadata{
+		UID:         "b0b9d0a4-0f4c-11e9-ab14-d663bd873d93",
+		Generation:  2,
+		Labels:      map[string]string{"app.kubernetes.io/name": "coredns"},
+		Annotations: map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"},
+		Managers:    []string{"kubectl-client-side-apply", "kubectl-edit"},
+	}
+	m.CreationTimestamp = exp.CreationTimestamp
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("Got %+v, expected %+v", m, exp)
+	}
+
+	m, err = Metadata(obj, report.Resource{GroupVersion: "v1", Name: "secrets"}, nil, []string{"kubectl.kubernetes.io/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Labels != nil || m.Annotations["kubectl.kubernetes.io/last-applied-configuration"] == "{}" {
+		t.Errorf("Got labels %v and annotations %v, expected no labels and redacted annotations", m.Labels, m.Annotations)
+	}
+}
@@ -3,26 +3,50 @@ package retrieval
 import (
 	"errors"
 	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/postfinance/kubewire/pkg/report"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
-// Resources retrieves all API resources, the result is sorted
-func Resources(config *rest.Config) ([]report.Resource, error) {
+// Resources retrieves all API resources of the cluster of config, see
+// DiscoverResources
+func Resources(config *rest.Config, opts Options) ([]report.Resource, error) {
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	// Discover resources
-	res, err := clientset.Discovery().ServerResources()
+	return DiscoverResources(clientset.Discovery(), opts)
+}
+
+// DiscoverResources retrieves all API resources with disco, the result is
+// sorted. If opts.PreferredVersions is set, only the preferred version of
+// every group is returned, unless a resource is not served in the preferred
+// version. If some API groups could not be discovered, the resources of the
+// other groups are returned along with a PartialError
+func DiscoverResources(disco discovery.DiscoveryInterface, opts Options) ([]report.Resource, error) {
+	// Discover resources, aggregated APIs may be unavailable
+	res, err := disco.ServerResources()
+	var failed []report.RetrievalError
+	if err != nil {
+		failed, err = discoveryErrors(err)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := disco.ServerGroups()
 	if err != nil {
 		return nil, err
 	}
@@ -31,92 +55,311 @@ func Resources(config *rest.Config) ([]report.Resource, error) {
 	rep := []report.Resource{}
 	for _, v := range res {
 		for _, resource := range v.APIResources {
+			verbs := make([]string, len(resource.Verbs))
+			copy(verbs, resource.Verbs)
+			sort.Strings(verbs)
+
 			res := report.Resource{
 				GroupVersion: v.GroupVersion,
 				Kind:         resource.Kind,
 				Namespaced:   resource.Namespaced,
 				Name:         resource.Name,
-				Listable:     sliceContains(resource.Verbs, "list"),
+				Verbs:        verbs,
 			}
+			res.Listable = res.HasVerb("list")
 			rep = append(rep, res)
 		}
 	}
 
+	rep = servedVersions(rep, groups, opts.PreferredVersions)
 	sort.Sort(report.ResourceSort(rep))
 
+	if len(failed) != 0 {
+		return rep, &PartialError{Errors: failed}
+	}
+
 	return rep, nil
 }
 
-// ResourceObjects retrieves all API resource objects which are global or
-// in the list of provided namespaces, the result is sorted
-func ResourceObjects(config *rest.Config, namespaces []string) ([]report.ResourceObject, error) {
-	// Create client
+// servedVersions records the versions every resource is served in, ordered by
+// the priority of the server. If preferred is set, only the resource of the
+// highest priority version is kept
+func servedVersions(resources []report.Resource, groups *meta_v1.APIGroupList, preferred bool) []report.Resource {
+	// Priority of the versions by group, the preferred version first
+	priority := map[string][]string{}
+	for _, g := range groups.Groups {
+		versions := []string{g.PreferredVersion.Version}
+		for _, v := range g.Versions {
+			if v.Version != g.PreferredVersion.Version {
+				versions = append(versions, v.Version)
+			}
+		}
+		priority[g.Name] = versions
+	}
+
+	// Served versions by group and resource name
+	served := map[string]map[string]bool{}
+	for _, r := range resources {
+		group, version := report.SplitGroupVersionSafe(r.GroupVersion)
+		key := group + " " + r.Name
+		if served[key] == nil {
+			served[key] = map[string]bool{}
+		}
+		served[key][version] = true
+	}
+
+	ret := []report.Resource{}
+	for _, r := range resources {
+		group, version := report.SplitGroupVersionSafe(r.GroupVersion)
+
+		versions := []string{}
+		for _, v := range priority[group] {
+			if served[group+" "+r.Name][v] {
+				versions = append(versions, v)
+			}
+		}
+
+		// Versions which are not part of the group list e.g. of a failed
+		// discovery
+		if len(versions) == 0 {
+			versions = append(versions, version)
+		}
+
+		if preferred && versions[0] != version {
+			continue
+		}
+
+		r.Versions = versions
+		ret = append(ret, r)
+	}
+
+	return ret
+}
+
+// Options defines what is retrieved about resources and resource objects
+type Options struct {
+	// PreferredVersions retrieves the resources only in the preferred version
+	// of their group, so that objects are not listed once per version
+	PreferredVersions bool
+	// ContentHash enables recording a fingerprint of the object content
+	ContentHash bool
+	// Content enables recording the normalized object content, this implies
+	// ContentHash
+	Content bool
+	// Concurrency limits the number of parallel list requests, values lower
+	// than 1 are treated as 1
+	Concurrency int
+	// PageSize limits the number of objects per list request, 0 lists all
+	// objects of a resource at once
+	PageSize int64
+	// Metadata enables recording the object metadata e.g. UID, owners and
+	// field managers
+	Metadata bool
+	// Labels and Annotations are the glob patterns of the label and
+	// annotation keys recorded in the metadata
+	Labels      []string
+	Annotations []string
+	// Strict aborts the retrieval on the first error, otherwise API groups
+	// which can not be discovered and resources which can not be listed are
+	// recorded in Result.Errors
+	Strict bool
+}
+
+// listRestarts defines how often a list is restarted after its continue token
+// has expired
+const listRestarts = 3
+
+// Result holds the retrieved resource objects and how long it took to list them
+type Result struct {
+	ResourceObjects []report.ResourceObject
+	Timings         []report.Timing
+	Errors          []report.RetrievalError
+}
+
+// listJob defines a single list request
+type listJob struct {
+	resource  report.Resource
+	namespace string
+}
+
+// ResourceObjects retrieves all API resource objects of the cluster of config,
+// see ListResourceObjects
+func ResourceObjects(config *rest.Config, namespaces []string, opts Options) (*Result, error) {
+	// Create clients
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	dyn, err := dynamic.NewForConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
+	return ListResourceObjects(clientset.Discovery(), dyn, namespaces, opts)
+}
+
+// ListResourceObjects retrieves all API resource objects which are global or
+// in the list of provided namespaces, the resources are discovered with disco
+// and listed with dyn. The result is sorted
+func ListResourceObjects(disco discovery.DiscoveryInterface, dyn dynamic.Interface, namespaces []string, opts Options) (*Result, error) {
 	// Get resources
-	resources, err := Resources(config)
-	if err != nil {
+	rep := &Result{
+		ResourceObjects: []report.ResourceObject{},
+		Errors:          []report.RetrievalError{},
+	}
+
+	resources, err := DiscoverResources(disco, opts)
+	if perr, ok := err.(*PartialError); ok && !opts.Strict {
+		rep.Errors = append(rep.Errors, perr.Errors...)
+	} else if err != nil {
 		return nil, err
 	}
 
-	rep := []report.ResourceObject{}
+	jobs := []listJob{}
 	for _, resource := range resources {
 		if !resource.Listable {
 			// do not try to scrape non listable objects
 			continue
 		}
 
-		// Parse Group/Version
-		gv, err2 := schema.ParseGroupVersion(resource.GroupVersion)
-		if err2 != nil {
-			return nil, err
+		if resource.Namespaced {
+			for _, ns := range namespaces {
+				jobs = append(jobs, listJob{resource: resource, namespace: ns})
+			}
+		} else {
+			jobs = append(jobs, listJob{resource: resource})
 		}
+	}
 
-		// Create Resource Interface
-		rif := dyn.Resource(gv.WithResource(resource.Name))
+	// Run the jobs in a worker pool, the results are stored by job index so
+	// that the order does not depend on the scheduling
+	items := make([][]report.ResourceObject, len(jobs))
+	timings := make([]report.Timing, len(jobs))
+	errs := make([]error, len(jobs))
 
-		// If namespaced
-		if resource.Namespaced {
-			for _, ns := range namespaces {
-				li, err := rif.Namespace(ns).List(meta_v1.ListOptions{})
-				if err != nil {
-					return nil, err
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var failed int32
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				// Skip the remaining jobs after an error
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
 				}
 
-				items, err := ExtractRuntimeObjectList(li, resource)
-				if err != nil {
-					return nil, err
+				start := time.Now()
+				items[i], errs[i] = list(dyn, jobs[i].resource, jobs[i].namespace, opts)
+				timings[i] = report.Timing{
+					GroupVersion: jobs[i].resource.GroupVersion,
+					Resource:     jobs[i].resource.Name,
+					Namespace:    jobs[i].namespace,
+					Duration:     time.Since(start),
+					Objects:      len(items[i]),
 				}
 
-				rep = append(rep, items...)
-			}
-		} else {
-			li, err := rif.List(meta_v1.ListOptions{})
-			if err != nil {
-				return nil, err
+				if errs[i] != nil && opts.Strict {
+					atomic.StoreInt32(&failed, 1)
+				}
 			}
+		}()
+	}
+
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
 
-			items, err := ExtractRuntimeObjectList(li, resource)
-			if err != nil {
-				return nil, err
+	rep.Timings = timings
+	for i := range jobs {
+		if errs[i] != nil {
+			if opts.Strict {
+				return nil, errs[i]
 			}
 
-			rep = append(rep, items...)
+			rep.Errors = append(rep.Errors, report.RetrievalError{
+				GroupVersion: jobs[i].resource.GroupVersion,
+				Resource:     jobs[i].resource.Name,
+				Namespace:    jobs[i].namespace,
+				Message:      errs[i].Error(),
+			})
+			continue
 		}
 
+		rep.ResourceObjects = append(rep.ResourceObjects, items[i]...)
 	}
 
 	// Sort results
-	sort.Sort(report.ResourceObjectSort(rep))
-	return rep, err
+	sort.Sort(report.ResourceObjectSort(rep.ResourceObjects))
+	return rep, nil
+}
+
+// list retrieves the objects of resource in the namespace ns, which is
+// ignored for global resources
+func list(dyn dynamic.Interface, resource report.Resource, ns string, opts Options) ([]report.ResourceObject, error) {
+	// Parse Group/Version
+	gv, err := schema.ParseGroupVersion(resource.GroupVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create Resource Interface
+	nrif := dyn.Resource(gv.WithResource(resource.Name))
+	var rif dynamic.ResourceInterface = nrif
+	if resource.Namespaced {
+		rif = nrif.Namespace(ns)
+	}
+
+	// Only the extracted fields of every page are kept, so that the memory
+	// usage does not depend on the size of the objects
+	rep := []report.ResourceObject{}
+	restarts := 0
+	listOpts := meta_v1.ListOptions{Limit: opts.PageSize}
+	for {
+		li, err := rif.List(listOpts)
+		if apierrors.IsResourceExpired(err) && restarts < listRestarts {
+			// The continue token has expired, the list has to be restarted as
+			// the objects may have changed in the meantime
+			restarts++
+			rep = rep[:0]
+			listOpts.Continue = ""
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := ExtractRuntimeObjectList(li, resource, opts)
+		if err != nil {
+			return nil, err
+		}
+		rep = append(rep, items...)
+
+		metadata, err := meta.ListAccessor(li)
+		if err != nil {
+			return nil, err
+		}
+
+		listOpts.Continue = metadata.GetContinue()
+		if listOpts.Continue == "" {
+			return rep, nil
+		}
+	}
 }
 
 // ExtractRuntimeObjectList extracts the list from a raw listing result and converts
 // it to a ResourceObject slice
-func ExtractRuntimeObjectList(li runtime.Object, resource report.Resource) ([]report.ResourceObject, error) {
+func ExtractRuntimeObjectList(li runtime.Object, resource report.Resource, opts Options) ([]report.ResourceObject, error) {
 	rep := []report.ResourceObject{}
 
 	// Parse list
@@ -127,36 +370,55 @@ func ExtractRuntimeObjectList(li runtime.Object, resource report.Resource) ([]re
 
 	// Iterate through objects
 	for _, item := range items {
-		unstructured, ok := item.(runtime.Unstructured)
-		if !ok {
-			return nil, errors.New("assertion to runtime.Unstructured failed")
-		}
-
-		metadata, err := meta.Accessor(unstructured)
+		obj, err := ExtractResourceObject(item, resource, opts)
 		if err != nil {
 			return nil, err
 		}
 
-		// Create a new ResourceObject
-		obj := report.ResourceObject{
-			GroupVersion: resource.GroupVersion,
-			Name:         metadata.GetName(),
-			Namespace:    metadata.GetNamespace(),
-			Resource:     resource.Name,
-		}
-
 		rep = append(rep, obj)
 	}
 
 	return rep, nil
 }
 
-func sliceContains(slice []string, str string) bool {
-	for _, v := range slice {
-		if v == str {
-			return true
+// ExtractResourceObject converts a single raw object of resource to a
+// ResourceObject
+func ExtractResourceObject(item runtime.Object, resource report.Resource, opts Options) (report.ResourceObject, error) {
+	unstructured, ok := item.(runtime.Unstructured)
+	if !ok {
+		return report.ResourceObject{}, errors.New("assertion to runtime.Unstructured failed")
+	}
+
+	metadata, err := meta.Accessor(unstructured)
+	if err != nil {
+		return report.ResourceObject{}, err
+	}
+
+	// Create a new ResourceObject
+	obj := report.ResourceObject{
+		GroupVersion: resource.GroupVersion,
+		Name:         metadata.GetName(),
+		Namespace:    metadata.GetNamespace(),
+		Resource:     resource.Name,
+	}
+
+	if opts.ContentHash || opts.Content {
+		obj.Hash, err = Fingerprint(unstructured)
+		if err != nil {
+			return report.ResourceObject{}, err
+		}
+	}
+
+	if opts.Content {
+		obj.Content = Content(unstructured, resource)
+	}
+
+	if opts.Metadata {
+		obj.Metadata, err = Metadata(unstructured, resource, opts.Labels, opts.Annotations)
+		if err != nil {
+			return report.ResourceObject{}, err
 		}
 	}
 
-	return false
+	return obj, nil
 }
@@ -0,0 +1,289 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"k8s.io/client-go/rest"
+)
+
+// fakeServer serves the discovery of the core group with namespaces and
+// configmaps and lists objects by path
+type fakeServer struct {
+	*httptest.Server
+	objects map[string][]string // object names by list path
+	expire  int                 // number of continue tokens to reject as expired
+	lists   int                 // number of list requests
+
+	brokenGroup bool // serve an API group whose discovery fails
+	appsGroup   bool // serve the apps group in multiple versions
+
+	mu sync.Mutex
+}
+
+func newFakeServer(objects map[string][]string) *fakeServer {
+	s := &fakeServer{objects: objects}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+func (s *fakeServer) config() *rest.Config {
+	return &rest.Config{Host: s.URL}
+}
+
+func (s *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var body interface{}
+
+	switch r.URL.Path {
+	case "/api":
+		body = map[string]interface{}{"kind": "APIVersions", "versions": []string{"v1"}}
+	case "/apis":
+		groups := []interface{}{}
+		if s.brokenGroup {
+			gv := map[string]interface{}{"groupVersion": "metrics.k8s.io/v1beta1", "version": "v1beta1"}
+			groups = append(groups, map[string]interface{}{"name": "metrics.k8s.io", "versions": []interface{}{gv}, "preferredVersion": gv})
+		}
+		if s.appsGroup {
+			v1 := map[string]interface{}{"groupVersion": "apps/v1", "version": "v1"}
+			v1beta2 := map[string]interface{}{"groupVersion": "apps/v1beta2", "version": "v1beta2"}
+			groups = append(groups, map[string]interface{}{"name": "apps", "versions": []interface{}{v1beta2, v1}, "preferredVersion": v1})
+		}
+		body = map[string]interface{}{"kind": "APIGroupList", "apiVersion": "v1", "groups": groups}
+	case "/apis/apps/v1":
+		body = map[string]interface{}{"kind": "APIResourceList", "groupVersion": "apps/v1", "resources": []interface{}{
+			map[string]interface{}{"name": "deployments", "kind": "Deployment", "namespaced": true, "verbs": []string{"list"}},
+		}}
+	case "/apis/apps/v1beta2":
+		body = map[string]interface{}{"kind": "APIResourceList", "groupVersion": "apps/v1beta2", "resources": []interface{}{
+			map[string]interface{}{"name": "deployments", "kind": "Deployment", "namespaced": true, "verbs": []string{"list"}},
+			map[string]interface{}{"name": "scales", "kind": "Scale", "namespaced": true, "verbs": []string{"get"}},
+		}}
+	case "/apis/metrics.k8s.io/v1beta1":
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	case "/api/v1":
+		body = map[string]interface{}{"kind": "APIResourceList", "groupVersion": "v1", "resources": []interface{}{
+			map[string]interface{}{"name": "namespaces", "kind": "Namespace", "namespaced": false, "verbs": []string{"get", "list"}},
+			map[string]interface{}{"name": "configmaps", "kind": "ConfigMap", "namespaced": true, "verbs": []string{"list", "get"}},
+			map[string]interface{}{"name": "bindings", "kind": "Binding", "namespaced": true, "verbs": []string{"create"}},
+		}}
+	default:
+		names, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.lists++
+
+		// The continue token is the offset of the next page
+		offset, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+		if offset != 0 && s.expire > 0 {
+			s.expire--
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(map[string]interface{}{"apiVersion": "v1", "kind": "Status", "status": "Failure", "reason": "Expired", "code": http.StatusGone})
+			return
+		}
+
+		next := ""
+		if limit, _ := strconv.Atoi(r.URL.Query().Get("limit")); limit != 0 && offset+limit < len(names) {
+			next = strconv.Itoa(offset + limit)
+			names = names[offset : offset+limit]
+		} else {
+			names = names[offset:]
+		}
+
+		items := []interface{}{}
+		for _, name := range names {
+			metadata := map[string]interface{}{"name": name}
+			if parts := strings.Split(r.URL.Path, "/"); len(parts) > 5 {
+				metadata["namespace"] = parts[4]
+			}
+			items = append(items, map[string]interface{}{"apiVersion": "v1", "kind": "Object", "metadata": metadata})
+		}
+		body = map[string]interface{}{"apiVersion": "v1", "kind": "List", "metadata": map[string]interface{}{"continue": next}, "items": items}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestResources(t *testing.T) {
+	s := newFakeServer(nil)
+	defer s.Close()
+
+	resources, err := Resources(s.config(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []report.Resource{
+		{GroupVersion: "v1", Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: []string{"create"}, Versions: []string{"v1"}},
+		{GroupVersion: "v1", Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Listable: true, Verbs: []string{"get", "list"}, Versions: []string{"v1"}},
+		{GroupVersion: "v1", Name: "namespaces", Kind: "Namespace", Listable: true, Verbs: []string{"get", "list"}, Versions: []string{"v1"}},
+	}
+	if !reflect.DeepEqual(resources, exp) {
+		t.Errorf("Got %+v, expected %+v", resources, exp)
+	}
+}
+
+func TestResourceObjectsConcurrency(t *testing.T) {
+	s := newFakeServer(map[string][]string{
+		"/api/v1/namespaces":                        {"kube-system", "default"},
+		"/api/v1/namespaces/default/configmaps":     {"x2", "x1"},
+		"/api/v1/namespaces/kube-system/configmaps": {"x3"},
+	})
+	defer s.Close()
+
+	exp := []string{
+		"v1 configmaps/default/x1",
+		"v1 configmaps/default/x2",
+		"v1 configmaps/kube-system/x3",
+		"v1 namespaces//default",
+		"v1 namespaces//kube-system",
+	}
+
+	for _, concurrency := range []int{0, 1, 4} {
+		result, err := ResourceObjects(s.config(), []string{"kube-system", "default"}, Options{Concurrency: concurrency})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		for _, obj := range result.ResourceObjects {
+			got = append(got, obj.String())
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("Got %v with concurrency %d, expected %v", got, concurrency, exp)
+		}
+
+		if len(result.Timings) != 3 {
+			t.Errorf("Got %d timings, expected 3", len(result.Timings))
+		}
+	}
+}
+
+func TestResourceObjectsStrict(t *testing.T) {
+	s := newFakeServer(map[string][]string{
+		"/api/v1/namespaces": {"default"},
+	})
+	defer s.Close()
+
+	_, err := ResourceObjects(s.config(), []string{"default"}, Options{Concurrency: 2, Strict: true})
+	if err == nil {
+		t.Errorf("Expected an error for the missing configmaps")
+	}
+}
+
+func TestResourceObjectsPartial(t *testing.T) {
+	s := newFakeServer(map[string][]string{
+		"/api/v1/namespaces": {"default"},
+	})
+	s.brokenGroup = true
+	defer s.Close()
+
+	result, err := ResourceObjects(s.config(), []string{"default"}, Options{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.ResourceObjects) != 1 {
+		t.Errorf("Got %v, expected the default namespace", result.ResourceObjects)
+	}
+
+	got := []string{}
+	for _, e := range result.Errors {
+		got = append(got, e.GroupVersion+" "+e.Resource+" "+e.Namespace)
+	}
+
+	exp := []string{"metrics.k8s.io/v1beta1  ", "v1 configmaps default"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Got errors %v, expected %v", got, exp)
+	}
+
+	_, err = Resources(s.config(), Options{})
+	if !IsPartialError(err) {
+		t.Errorf("Got %v, expected a PartialError", err)
+	}
+}
+
+func TestResourceObjectsPaging(t *testing.T) {
+	s := newFakeServer(map[string][]string{
+		"/api/v1/namespaces": {"n1", "n2", "n3", "n4", "n5"},
+	})
+	defer s.Close()
+
+	result, err := ResourceObjects(s.config(), []string{}, Options{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.ResourceObjects) != 5 || s.lists != 3 {
+		t.Errorf("Got %d objects with %d requests, expected 5 objects with 3 requests", len(result.ResourceObjects), s.lists)
+	}
+}
+
+func TestResourceObjectsPagingExpired(t *testing.T) {
+	s := newFakeServer(map[string][]string{
+		"/api/v1/namespaces": {"n1", "n2", "n3", "n4", "n5"},
+	})
+	s.expire = 1
+	defer s.Close()
+
+	result, err := ResourceObjects(s.config(), []string{}, Options{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, obj := range result.ResourceObjects {
+		got = append(got, obj.Name)
+	}
+
+	exp := []string{"n1", "n2", "n3", "n4", "n5"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Got %v, expected %v", got, exp)
+	}
+}
+
+func TestResourcesPreferredVersions(t *testing.T) {
+	s := newFakeServer(nil)
+	s.appsGroup = true
+	defer s.Close()
+
+	for _, test := range []struct {
+		preferred bool
+		exp       []string
+	}{
+		{false, []string{"apps/v1 deployments [v1 v1beta2]", "apps/v1beta2 deployments [v1 v1beta2]", "apps/v1beta2 scales [v1beta2]"}},
+		{true, []string{"apps/v1 deployments [v1 v1beta2]", "apps/v1beta2 scales [v1beta2]"}},
+	} {
+		resources, err := Resources(s.config(), Options{PreferredVersions: test.preferred})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		for _, r := range resources {
+			if r.GroupVersion != "v1" {
+				got = append(got, fmt.Sprintf("%s %s %v", r.GroupVersion, r.Name, r.Versions))
+			}
+		}
+
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("Got %v with preferred %t, expected %v", got, test.preferred, test.exp)
+		}
+	}
+}
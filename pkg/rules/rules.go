@@ -0,0 +1,425 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+// Scopes of a rule
+const (
+	// ScopeObject evaluates the rule for every resource object
+	ScopeObject = "object"
+	// ScopeReport evaluates the rule once for the whole report
+	ScopeReport = "report"
+)
+
+// RuleSet holds the rules and the tests which verify them against snapshot
+// files
+type RuleSet struct {
+	Rules []Rule
+	Tests []Test `yaml:",omitempty" json:",omitempty"`
+}
+
+// Rule reports a finding with its severity and message whenever its
+// expression, written in the Common Expression Language (CEL) with the string
+// extensions, is true.
+//
+// The expression can use the variables:
+//
+//	object   the resource object with groupVersion, group, version, resource,
+//	         kind, namespace, name and, if recorded, hash, content and metadata
+//	changes  the change types of the object to the baseline e.g. ["added"],
+//	         empty without a baseline
+//	report   the report with scanStart, scanEnd, server, configuration,
+//	         resources, objects and errors
+//
+// Rules with the scope report are evaluated once and only see report.
+type Rule struct {
+	ID          string
+	Description string `yaml:",omitempty" json:",omitempty"`
+	Severity    string `yaml:",omitempty" json:",omitempty"` // info|warning|critical, empty for warning
+	Scope       string `yaml:",omitempty" json:",omitempty"` // object|report, empty for object
+	Expression  string
+	// Message is a text/template with the variables as data e.g.
+	// 'Webhook {{.object.name}} is new', empty for the description
+	Message string `yaml:",omitempty" json:",omitempty"`
+
+	program cel.Program
+	message *template.Template
+}
+
+// Test expects the findings of the rules for a snapshot and optionally a
+// baseline. The findings are given by their String() e.g.
+// 'webhook-added admissionregistration.k8s.io/v1beta1
+// validatingwebhookconfigurations//x'.
+type Test struct {
+	Description string `yaml:",omitempty" json:",omitempty"`
+	Snapshot    string
+	Baseline    string `yaml:",omitempty" json:",omitempty"`
+	Expect      []string
+}
+
+// Finding is a rule whose expression is true for a resource object or, if
+// ResourceObject is nil, for the report
+type Finding struct {
+	Rule           string
+	Severity       string
+	Message        string
+	ResourceObject *report.ResourceObject `yaml:",omitempty" json:",omitempty"`
+	Changes        []string               `yaml:",omitempty" json:",omitempty"`
+}
+
+func (f Finding) String() string {
+	if f.ResourceObject == nil {
+		return f.Rule
+	}
+
+	return f.Rule + " " + f.ResourceObject.String()
+}
+
+// EvaluationError is an expression which could not be evaluated e.g. as it
+// selects a field which does not exist
+type EvaluationError struct {
+	Rule           string
+	ResourceObject *report.ResourceObject `yaml:",omitempty" json:",omitempty"`
+	Message        string
+}
+
+func (e EvaluationError) String() string {
+	if e.ResourceObject == nil {
+		return fmt.Sprintf("%s: %s", e.Rule, e.Message)
+	}
+
+	return fmt.Sprintf("%s %s: %s", e.Rule, e.ResourceObject, e.Message)
+}
+
+// Result holds the findings and evaluation errors of the rules
+type Result struct {
+	Findings []Finding
+	Errors   []EvaluationError `yaml:",omitempty" json:",omitempty"`
+}
+
+// Count returns the number of findings with one of the severities
+func (r Result) Count(severities []string) int {
+	n := 0
+	for _, f := range r.Findings {
+		for _, s := range severities {
+			if f.Severity == s {
+				n++
+				break
+			}
+		}
+	}
+
+	return n
+}
+
+// Compile validates and compiles all rules, it must be called before
+// evaluating
+func (s *RuleSet) Compile() error {
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("changes", cel.DynType),
+		cel.Variable("report", cel.DynType),
+		ext.Strings(),
+	)
+	if err != nil {
+		return err
+	}
+
+	ids := map[string]bool{}
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if r.ID == "" {
+			return fmt.Errorf("rule %d: id is required", i+1)
+		}
+		if ids[r.ID] {
+			return fmt.Errorf("rule %s: duplicate id", r.ID)
+		}
+		ids[r.ID] = true
+
+		if err := r.compile(env); err != nil {
+			return fmt.Errorf("rule %s: %s", r.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Rule) compile(env *cel.Env) error {
+	switch r.Severity {
+	case "", report.SeverityInfo, report.SeverityWarning, report.SeverityCritical:
+	default:
+		return fmt.Errorf("unknown severity %s", r.Severity)
+	}
+
+	switch r.Scope {
+	case "", ScopeObject, ScopeReport:
+	default:
+		return fmt.Errorf("unknown scope %s", r.Scope)
+	}
+
+	ast, issues := env.Compile(r.Expression)
+	if issues != nil && issues.Err() != nil {
+		return fmt.Errorf("expression: %s", issues.Err())
+	}
+
+	var err error
+	if r.program, err = env.Program(ast); err != nil {
+		return fmt.Errorf("expression: %s", err)
+	}
+
+	message := r.Message
+	if message == "" {
+		message = r.Description
+	}
+	if r.message, err = template.New(r.ID).Option("missingkey=zero").Parse(message); err != nil {
+		return fmt.Errorf("message: %s", err)
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the compiled rules for rep. If baseline is not nil, the
+// objects have the change types of the differences to it and the objects which
+// were removed since the baseline are evaluated as well.
+func (s *RuleSet) Evaluate(rep report.Report, baseline *report.Report) Result {
+	ret := Result{Findings: []Finding{}}
+
+	objects := rep.ResourceObjects
+	changes := map[string][]string{} // by Key()
+	if baseline != nil {
+		removed := map[string]bool{}
+		for _, d := range report.DiffReports(*baseline, rep, nil).Differences {
+			if d.ResourceObject == nil {
+				continue
+			}
+
+			key := d.ResourceObject.Key()
+			if !containsString(changes[key], d.Kind) {
+				changes[key] = append(changes[key], d.Kind)
+			}
+			removed[key] = removed[key] || d.Kind == report.ChangeRemoved
+		}
+
+		objects = append([]report.ResourceObject{}, objects...)
+		for _, o := range baseline.ResourceObjects {
+			if removed[o.Key()] {
+				objects = append(objects, o)
+			}
+		}
+	}
+
+	kinds := map[string]string{}
+	for _, r := range rep.Resources {
+		kinds[r.GroupVersion+" "+r.Name] = r.Kind
+	}
+
+	vars := map[string]interface{}{}
+	values := make([]interface{}, len(objects))
+	for i, o := range objects {
+		values[i] = objectValue(o, kinds[o.GroupVersion+" "+o.Resource])
+	}
+	vars["report"] = reportValue(rep, values)
+
+	for _, r := range s.Rules {
+		if r.Scope == ScopeReport {
+			delete(vars, "object")
+			delete(vars, "changes")
+			r.evaluate(vars, nil, nil, &ret)
+			continue
+		}
+
+		for i, o := range objects {
+			c := changes[o.Key()]
+			vars["object"] = values[i]
+			vars["changes"] = append([]string{}, c...)
+			r.evaluate(vars, &objects[i], c, &ret)
+		}
+	}
+
+	return ret
+}
+
+// evaluate adds the finding or evaluation error of the rule for the object o,
+// nil for the report, to ret
+func (r Rule) evaluate(vars map[string]interface{}, o *report.ResourceObject, changes []string, ret *Result) {
+	var identity *report.ResourceObject
+	if o != nil {
+		// The content and metadata are not part of the identity
+		t := *o
+		t.Content = nil
+		t.Metadata = nil
+		identity = &t
+	}
+
+	v, _, err := r.program.Eval(vars)
+	if err == nil {
+		if _, ok := v.Value().(bool); !ok {
+			err = fmt.Errorf("expression must be bool, not %s", v.Type().TypeName())
+		}
+	}
+	if err != nil {
+		ret.Errors = append(ret.Errors, EvaluationError{Rule: r.ID, ResourceObject: identity, Message: err.Error()})
+		return
+	}
+
+	if v.Value() != true {
+		return
+	}
+
+	message := &bytes.Buffer{}
+	if err := r.message.Execute(message, vars); err != nil {
+		ret.Errors = append(ret.Errors, EvaluationError{Rule: r.ID, ResourceObject: identity, Message: "message: " + err.Error()})
+	}
+
+	severity := r.Severity
+	if severity == "" {
+		severity = report.SeverityWarning
+	}
+
+	ret.Findings = append(ret.Findings, Finding{
+		Rule:           r.ID,
+		Severity:       severity,
+		Message:        message.String(),
+		ResourceObject: identity,
+		Changes:        changes,
+	})
+}
+
+// objectValue returns the variable object of o
+func objectValue(o report.ResourceObject, kind string) map[string]interface{} {
+	group, version := report.SplitGroupVersionSafe(o.GroupVersion)
+
+	ret := map[string]interface{}{
+		"groupVersion": o.GroupVersion,
+		"group":        group,
+		"version":      version,
+		"resource":     o.Resource,
+		"kind":         kind,
+		"namespace":    o.Namespace,
+		"name":         o.Name,
+	}
+
+	if o.Hash != "" {
+		ret["hash"] = o.Hash
+	}
+
+	if o.Content != nil {
+		ret["content"] = o.Content
+	}
+
+	if m := o.Metadata; m != nil {
+		owners := []interface{}{}
+		for _, owner := range m.Owners {
+			owners = append(owners, map[string]interface{}{
+				"apiVersion": owner.APIVersion,
+				"kind":       owner.Kind,
+				"name":       owner.Name,
+				"controller": owner.Controller,
+			})
+		}
+
+		ret["metadata"] = map[string]interface{}{
+			"uid":               m.UID,
+			"creationTimestamp": m.CreationTimestamp.Format(time.RFC3339),
+			"generation":        m.Generation,
+			"labels":            m.Labels,
+			"annotations":       m.Annotations,
+			"owners":            owners,
+			"managers":          append([]string{}, m.Managers...),
+		}
+	}
+
+	return ret
+}
+
+// reportValue returns the variable report of rep with the values of its
+// objects
+func reportValue(rep report.Report, objects []interface{}) map[string]interface{} {
+	resources := []interface{}{}
+	for _, r := range rep.Resources {
+		group, version := report.SplitGroupVersionSafe(r.GroupVersion)
+		resources = append(resources, map[string]interface{}{
+			"groupVersion": r.GroupVersion,
+			"group":        group,
+			"version":      version,
+			"name":         r.Name,
+			"kind":         r.Kind,
+			"namespaced":   r.Namespaced,
+			"verbs":        append([]string{}, r.Verbs...),
+		})
+	}
+
+	errors := []interface{}{}
+	for _, e := range rep.Errors {
+		errors = append(errors, map[string]interface{}{
+			"groupVersion": e.GroupVersion,
+			"resource":     e.Resource,
+			"namespace":    e.Namespace,
+			"message":      e.Message,
+		})
+	}
+
+	return map[string]interface{}{
+		"scanStart": rep.ScanStart.Format(time.RFC3339),
+		"scanEnd":   rep.ScanEnd.Format(time.RFC3339),
+		"server": map[string]interface{}{
+			"host":    rep.Server.Host,
+			"version": rep.Server.Version,
+		},
+		"configuration": map[string]interface{}{
+			"namespaces": append([]string{}, rep.Configuration.Namespaces...),
+			"context":    rep.Configuration.Context,
+			"identity":   rep.Configuration.Identity,
+		},
+		"resources": resources,
+		"objects":   objects,
+		"errors":    errors,
+	}
+}
+
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verify compares the findings of result with the expected ones of the test
+// and returns the missing and the unexpected findings
+func (t Test) Verify(result Result) (missing, unexpected []string) {
+	expected := map[string]bool{}
+	for _, e := range t.Expect {
+		expected[e] = true
+	}
+
+	found := map[string]bool{}
+	for _, f := range result.Findings {
+		found[f.String()] = true
+		if !expected[f.String()] {
+			unexpected = append(unexpected, f.String())
+		}
+	}
+
+	for _, e := range t.Expect {
+		if !found[e] {
+			missing = append(missing, e)
+		}
+	}
+
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+
+	return missing, unexpected
+}
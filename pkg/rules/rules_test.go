@@ -0,0 +1,155 @@
+package rules
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func readYaml(t *testing.T, file string, v interface{}) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := yaml.UnmarshalStrict(raw, v); err != nil {
+		t.Fatalf("%s: %s", file, err)
+	}
+}
+
+func TestRuleSetTests(t *testing.T) {
+	set := &RuleSet{}
+	readYaml(t, "rules.yaml", set)
+	if err := set.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range set.Tests {
+		rep := report.Report{}
+		readYaml(t, test.Snapshot, &rep)
+
+		var baseline *report.Report
+		if test.Baseline != "" {
+			baseline = &report.Report{}
+			readYaml(t, test.Baseline, baseline)
+		}
+
+		result := set.Evaluate(rep, baseline)
+		if missing, unexpected := test.Verify(result); len(missing) != 0 || len(unexpected) != 0 {
+			t.Errorf("%s: missing %v, unexpected %v", test.Description, missing, unexpected)
+		}
+
+		if len(result.Errors) != 0 {
+			t.Errorf("%s: got evaluation errors %v", test.Description, result.Errors)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	set := &RuleSet{}
+	readYaml(t, "rules.yaml", set)
+	if err := set.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, baseline := report.Report{}, report.Report{}
+	readYaml(t, "snapshot.yaml", &rep)
+	readYaml(t, "baseline.yaml", &baseline)
+
+	result := set.Evaluate(rep, &baseline)
+	exp := map[string]Finding{
+		"webhook-added":      {Severity: report.SeverityCritical, Message: "ValidatingWebhookConfiguration shouldnotbehere is new"},
+		"cluster-admin-user": {Severity: report.SeverityWarning, Message: "backdoor binds cluster-admin to a user"},
+		"namespace-removed":  {Severity: report.SeverityInfo, Message: "Namespace appl-old was removed"},
+		"incomplete-scan":    {Severity: report.SeverityWarning, Message: "1 resources could not be listed"},
+	}
+
+	for _, f := range result.Findings {
+		e := exp[f.Rule]
+		if f.Severity != e.Severity || f.Message != e.Message {
+			t.Errorf("Got %+v, expected %+v", f, e)
+		}
+
+		if f.ResourceObject != nil && f.ResourceObject.Content != nil {
+			t.Errorf("Got content in the identity of %s", f)
+		}
+	}
+
+	if n := result.Count([]string{report.SeverityCritical, report.SeverityWarning}); n != 3 {
+		t.Errorf("Got %d findings, expected 3 critical or warning ones", n)
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	set := &RuleSet{Rules: []Rule{
+		{ID: "content", Expression: `object.content.kind == "Secret"`},
+		{ID: "not-bool", Expression: `object.name`},
+	}}
+	if err := set.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := report.Report{ResourceObjects: []report.ResourceObject{{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "x"}}}
+	result := set.Evaluate(rep, nil)
+	if len(result.Findings) != 0 || len(result.Errors) != 2 {
+		t.Fatalf("Got %v and errors %v, expected two errors", result.Findings, result.Errors)
+	}
+
+	if s := result.Errors[0].String(); s != "content v1 secrets/default/x: no such key: content" {
+		t.Errorf("Got %s", s)
+	}
+}
+
+func TestEvaluateExpressions(t *testing.T) {
+	set := &RuleSet{Rules: []Rule{
+		{ID: "absorbed", Expression: `object.content.kind == "Secret" || object.resource == "secrets"`},
+		{ID: "has", Expression: `!has(object.content) && has(object.name)`},
+		{ID: "strings", Expression: `object.name.lowerAscii().startsWith("x") && object.name.matches("^X")`},
+		{ID: "changes", Expression: `size(changes) == 0 && !("added" in changes)`},
+		{ID: "report", Expression: `report.objects.exists(o, o.name == "X")`, Scope: ScopeReport},
+		{ID: "false", Expression: `object.namespace == "kube-system"`},
+	}}
+	if err := set.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := report.Report{ResourceObjects: []report.ResourceObject{{GroupVersion: "v1", Resource: "secrets", Namespace: "default", Name: "X"}}}
+	result := set.Evaluate(rep, nil)
+	if len(result.Errors) != 0 {
+		t.Fatalf("Got errors %v", result.Errors)
+	}
+
+	rules := []string{}
+	for _, f := range result.Findings {
+		rules = append(rules, f.Rule)
+	}
+	if exp := []string{"absorbed", "has", "strings", "changes", "report"}; !reflect.DeepEqual(rules, exp) {
+		t.Errorf("Got the findings of %v, expected %v", rules, exp)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, r := range []Rule{
+		{Expression: "true"},
+		{ID: "x", Expression: "true &&"},
+		{ID: "x", Expression: "true", Severity: "high"},
+		{ID: "x", Expression: "true", Scope: "cluster"},
+		{ID: "x", Expression: "true", Message: "{{.object"},
+		{ID: "x", Expression: "object.unknown("},
+		{ID: "x", Expression: "size(1, 2)"},
+	} {
+		set := &RuleSet{Rules: []Rule{r}}
+		if err := set.Compile(); err == nil {
+			t.Errorf("Expected an error for %+v", r)
+		}
+	}
+
+	set := &RuleSet{Rules: []Rule{{ID: "x", Expression: "true"}, {ID: "x", Expression: "false"}}}
+	if err := set.Compile(); err == nil {
+		t.Errorf("Expected an error for duplicate ids")
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// resourceLabels are the labels of the metrics by resource and namespace
+var resourceLabels = []string{"groupversion", "resource", "namespace"}
+
+// changes are the change types of kubewire_drift_changes, which are exposed
+// even if there is no such difference
+var changes = []string{report.ChangeAdded, report.ChangeRemoved, report.ChangeModified, report.ChangeSchema, report.ChangeMetadata, report.ChangeUnknown,
+	report.ChangeRecreated, report.ChangeNewManager}
+
+// metrics holds the Prometheus metrics of a Server in its own registry
+type metrics struct {
+	registry *prometheus.Registry
+
+	scans        prometheus.Counter
+	failures     prometheus.Counter
+	duration     prometheus.Gauge
+	lastSuccess  prometheus.Gauge
+	changes      *prometheus.GaugeVec
+	driftObjects *prometheus.GaugeVec
+	listErrors   *prometheus.GaugeVec
+	objects      *prometheus.GaugeVec
+	listDuration *prometheus.GaugeVec
+}
+
+// newMetrics creates and registers the metrics
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		scans: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kubewire_scans_total",
+			Help: "Number of scans of the cluster.",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kubewire_scan_failures_total",
+			Help: "Number of failed scans of the cluster.",
+		}),
+		duration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kubewire_scan_duration_seconds",
+			Help: "Duration of the last scan.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kubewire_last_successful_scan_timestamp_seconds",
+			Help: "Time of the last successful scan since the epoch.",
+		}),
+		changes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kubewire_drift_changes",
+			Help: "Number of differences to the baseline of the last successful scan by change type.",
+		}, []string{"change"}),
+		driftObjects: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kubewire_drift_objects",
+			Help: "Number of resource objects which differ from the baseline by change type, resource and namespace.",
+		}, []string{"kind", "group", "resource", "namespace"}),
+		listErrors: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kubewire_list_errors",
+			Help: "API groups which could not be discovered or resources which could not be listed in the last successful scan.",
+		}, resourceLabels),
+		objects: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kubewire_objects",
+			Help: "Number of resource objects by resource and namespace in the last successful scan.",
+		}, resourceLabels),
+		listDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kubewire_list_duration_seconds",
+			Help: "Duration of listing the objects of a resource in the last successful scan.",
+		}, resourceLabels),
+	}
+
+	m.registry.MustRegister(m.scans, m.failures, m.duration, m.lastSuccess, m.changes, m.driftObjects, m.listErrors, m.objects, m.listDuration)
+
+	return m
+}
+
+// observeScan records a scan which took duration and failed if err is not nil
+func (m *metrics) observeScan(duration time.Duration, err error) {
+	m.scans.Inc()
+	m.duration.Set(duration.Seconds())
+	if err != nil {
+		m.failures.Inc()
+	}
+}
+
+// observeResult replaces the metrics of the last successful scan by the ones
+// of the live report and its result finished at end
+func (m *metrics) observeResult(live *report.Report, result report.DiffResult, end time.Time) {
+	m.lastSuccess.Set(float64(end.UnixNano()) / 1e9)
+
+	m.changes.Reset()
+	for _, c := range changes {
+		m.changes.WithLabelValues(c).Set(float64(result.Changes[c]))
+	}
+
+	// Objects with multiple differences are counted once
+	m.driftObjects.Reset()
+	seen := map[string]bool{}
+	for _, d := range result.Differences {
+		o := d.ResourceObject
+		if o == nil || seen[d.Kind+" "+o.Key()] {
+			continue
+		}
+		seen[d.Kind+" "+o.Key()] = true
+
+		group, _ := report.SplitGroupVersionSafe(o.GroupVersion)
+		m.driftObjects.WithLabelValues(d.Kind, group, o.Resource, o.Namespace).Inc()
+	}
+
+	m.listErrors.Reset()
+	for _, e := range live.Errors {
+		m.listErrors.WithLabelValues(e.GroupVersion, e.Resource, e.Namespace).Set(1)
+	}
+
+	m.objects.Reset()
+	m.listDuration.Reset()
+	for _, t := range live.Timings {
+		m.objects.WithLabelValues(t.GroupVersion, t.Resource, t.Namespace).Set(float64(t.Objects))
+		m.listDuration.WithLabelValues(t.GroupVersion, t.Resource, t.Namespace).Set(t.Duration.Seconds())
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Scanner creates a report of the live cluster, it is called with the
+// configuration of the baseline
+type Scanner func(conf report.Configuration) (*report.Report, error)
+
+// Server periodically compares a cluster with a baseline and exposes the
+// results as Prometheus metrics
+type Server struct {
+	baseline report.Report
+	ignore   *report.Ignore
+	scan     Scanner
+	onScan   func(live *report.Report, result report.DiffResult)
+
+	// mu guards the metrics, so that a scrape does not see the ones of a scan
+	// partially updated
+	mu      sync.RWMutex
+	metrics *metrics
+	result  *report.DiffResult // of the last successful scan
+}
+
+// New creates a Server for the baseline, ignore may be nil and must be
+// compiled otherwise
+func New(baseline report.Report, ignore *report.Ignore, scan Scanner) *Server {
+	return &Server{
+		baseline: baseline,
+		ignore:   ignore,
+		scan:     scan,
+		metrics:  newMetrics(),
+	}
+}
+
+// OnScan registers f to be called with the result of every successful scan,
+// e.g. to publish it elsewhere. It must be called before Run.
+func (s *Server) OnScan(f func(live *report.Report, result report.DiffResult)) {
+	s.onScan = f
+}
+
+// Scan scans the cluster once and updates the metrics
+func (s *Server) Scan() error {
+	start := time.Now()
+	live, err := s.scan(s.baseline.Configuration)
+	duration := time.Since(start)
+
+	var result report.DiffResult
+	if err == nil {
+		result = report.DiffReports(s.baseline, *live, s.ignore)
+	}
+
+	s.mu.Lock()
+	s.metrics.observeScan(duration, err)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	s.metrics.observeResult(live, result, time.Now())
+	s.result = &result
+	s.mu.Unlock()
+
+	if s.onScan != nil {
+		s.onScan(live, result)
+	}
+
+	return nil
+}
+
+// Run scans the cluster every interval until stop is closed, the first scan
+// is run immediately
+func (s *Server) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Scan(); err != nil {
+			log.Println("scan failed:", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ready returns true as soon as a scan has succeeded
+func (s *Server) Ready() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.result != nil
+}
+
+// Handler returns the HTTP handler serving /metrics, /healthz and /readyz
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		return s.metrics.registry.Gather()
+	})
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			http.Error(w, "no successful scan yet", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	return mux
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/retrieval"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeCluster serves v1 namespaces, configmaps and secrets with the fake
+// discovery and dynamic clients of client-go, listing secrets is forbidden. Its
+// discovery fails while it is down.
+type fakeCluster struct {
+	*fakediscovery.FakeDiscovery
+	dyn  *fakedynamic.FakeDynamicClient
+	down bool
+}
+
+func newFakeCluster(objects ...runtime.Object) *fakeCluster {
+	verbs := meta_v1.Verbs{"get", "list", "watch"}
+	c := &fakeCluster{
+		FakeDiscovery: &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*meta_v1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "configmaps", Namespaced: true, Kind: "ConfigMap", Verbs: verbs},
+				{Name: "namespaces", Kind: "Namespace", Verbs: verbs},
+				{Name: "secrets", Namespaced: true, Kind: "Secret", Verbs: verbs},
+			},
+		}}}},
+		dyn: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), objects...),
+	}
+
+	c.dyn.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("denied"))
+	})
+
+	return c
+}
+
+func (c *fakeCluster) ServerResources() ([]*meta_v1.APIResourceList, error) {
+	if c.down {
+		return nil, errors.New("connection refused")
+	}
+
+	return c.FakeDiscovery.ServerResources()
+}
+
+// scan retrieves a report of the cluster like a scan of kubewire serve
+func (c *fakeCluster) scan(conf report.Configuration) (*report.Report, error) {
+	result, err := retrieval.ListResourceObjects(c, c.dyn, conf.Namespaces, retrieval.Options{ContentHash: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return &report.Report{
+		Configuration:   conf,
+		ResourceObjects: result.ResourceObjects,
+		Timings:         result.Timings,
+		Errors:          result.Errors,
+	}, nil
+}
+
+func newObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      name,
+		},
+	}}
+}
+
+func get(t *testing.T, srv *httptest.Server, path string) (int, string) {
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(body)
+}
+
+func TestServer(t *testing.T) {
+	baseline := report.Report{
+		Configuration: report.Configuration{Namespaces: []string{"kube-system"}},
+		ResourceObjects: []report.ResourceObject{
+			{GroupVersion: "v1", Resource: "configmaps", Namespace: "kube-system", Name: "coredns", Hash: "sha256:1"},
+			{GroupVersion: "v1", Resource: "namespaces", Name: "default"},
+		},
+	}
+
+	cluster := newFakeCluster(
+		newObject("v1", "ConfigMap", "kube-system", "coredns"),
+		newObject("v1", "Namespace", "", "appl-shouldnotbehere"),
+		newObject("v1", "Namespace", "", "default"),
+	)
+	cluster.down = true
+
+	s := New(baseline, nil, cluster.scan)
+	published := []report.DiffResult{}
+	s.OnScan(func(live *report.Report, result report.DiffResult) {
+		published = append(published, result)
+	})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	if code, _ := get(t, srv, "/healthz"); code != http.StatusOK {
+		t.Errorf("Got status %d for /healthz", code)
+	}
+
+	// Failed scan
+	if err := s.Scan(); err == nil {
+		t.Error("Expected the scan to fail")
+	}
+
+	if code, _ := get(t, srv, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Got status %d for /readyz before the first successful scan", code)
+	}
+
+	_, body := get(t, srv, "/metrics")
+	for _, exp := range []string{"kubewire_scans_total 1\n", "kubewire_scan_failures_total 1\n"} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("Expected %q in metrics:\n%s", exp, body)
+		}
+	}
+	if strings.Contains(body, "kubewire_drift_changes") {
+		t.Errorf("Expected no drift metrics without successful scan:\n%s", body)
+	}
+
+	// Successful scan
+	cluster.down = false
+	if err := s.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(published) != 1 || published[0].Changes[report.ChangeAdded] != 1 {
+		t.Errorf("Got published results %+v, expected the one of the successful scan", published)
+	}
+
+	if code, _ := get(t, srv, "/readyz"); code != http.StatusOK {
+		t.Errorf("Got status %d for /readyz", code)
+	}
+
+	_, body = get(t, srv, "/metrics")
+	for _, exp := range []string{
+		"kubewire_scans_total 2\n",
+		"# TYPE kubewire_drift_objects gauge\n",
+		`kubewire_drift_changes{change="added"} 1` + "\n",
+		`kubewire_drift_changes{change="modified"} 1` + "\n",
+		`kubewire_drift_changes{change="removed"} 0` + "\n",
+		`kubewire_drift_objects{group="",kind="added",namespace="",resource="namespaces"} 1` + "\n",
+		`kubewire_drift_objects{group="",kind="modified",namespace="kube-system",resource="configmaps"} 1` + "\n",
+		`kubewire_list_errors{groupversion="v1",namespace="kube-system",resource="secrets"} 1` + "\n",
+		`kubewire_objects{groupversion="v1",namespace="",resource="namespaces"} 2` + "\n",
+		`kubewire_objects{groupversion="v1",namespace="kube-system",resource="configmaps"} 1` + "\n",
+		`kubewire_objects{groupversion="v1",namespace="kube-system",resource="secrets"} 0` + "\n",
+		`kubewire_list_duration_seconds{groupversion="v1",namespace="",resource="namespaces"} `,
+		"kubewire_last_successful_scan_timestamp_seconds ",
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("Expected %q in metrics:\n%s", exp, body)
+		}
+	}
+}
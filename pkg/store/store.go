@@ -0,0 +1,328 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// References to snapshots of a store, every other reference starting with @ is
+// resolved as ID
+const (
+	// RefLatest references the newest snapshot
+	RefLatest = "@latest"
+	// RefBaseline references the snapshot marked as baseline
+	RefBaseline = "@baseline"
+)
+
+// idFormat defines the time format of the snapshot IDs
+const idFormat = "20060102-150405"
+
+// validID matches snapshot IDs, an optional suffix distinguishes snapshots
+// taken within the same second
+var validID = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}(-[0-9]+)?$`)
+
+// ErrNotFound is returned if a referenced snapshot does not exist
+var ErrNotFound = errors.New("snapshot not found")
+
+// Store persists snapshots in a directory. Every snapshot is stored in yaml
+// format as snapshots/<ID>.yaml, the ID of the baseline in the file baseline.
+type Store struct {
+	dir string
+}
+
+// Entry describes a stored snapshot
+type Entry struct {
+	ID              string
+	Time            time.Time
+	Server          string
+	ResourceObjects int
+	Baseline        bool
+}
+
+// Open opens the store in dir, which is created if it does not exist
+func Open(dir string) (*Store, error) {
+	s := &Store{dir: dir}
+
+	err := os.MkdirAll(s.snapshotDir(), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// IsRef returns true if s is a store reference instead of a file path
+func IsRef(s string) bool {
+	return strings.HasPrefix(s, "@")
+}
+
+// Save stores the snapshot rep and returns its ID, which is derived from the
+// start of the scan
+func (s *Store) Save(rep report.Report) (string, error) {
+	raw, err := yaml.Marshal(rep)
+	if err != nil {
+		return "", err
+	}
+
+	// The file is created exclusively, so that concurrent saves of the same
+	// scan start get their own IDs
+	base := rep.ScanStart.UTC().Format(idFormat)
+	id := base
+	for n := 2; ; n++ {
+		f, err := os.OpenFile(s.snapshotFile(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	// The reserved file is replaced atomically
+	err = WriteFile(s.snapshotFile(id), raw, 0600)
+	if err != nil {
+		os.Remove(s.snapshotFile(id))
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Load reads the snapshot referenced by ref
+func (s *Store) Load(ref string) (*report.Report, error) {
+	id, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := ioutil.ReadFile(s.snapshotFile(id))
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &report.Report{}
+	err = yaml.Unmarshal(raw, rep)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %s", id, err)
+	}
+
+	return rep, nil
+}
+
+// Resolve returns the ID of the snapshot referenced by ref, which is either
+// @latest, @baseline, an ID or an ID prefixed by @
+func (s *Store) Resolve(ref string) (string, error) {
+	switch ref {
+	case RefLatest:
+		ids, err := s.ids()
+		if err != nil {
+			return "", err
+		}
+		if len(ids) == 0 {
+			return "", fmt.Errorf("%s: %s", ref, ErrNotFound)
+		}
+		return ids[len(ids)-1], nil
+	case RefBaseline:
+		id, err := s.Baseline()
+		if err != nil {
+			return "", err
+		}
+		if id == "" {
+			return "", fmt.Errorf("%s: no baseline set", ref)
+		}
+		return id, nil
+	}
+
+	id := strings.TrimPrefix(ref, "@")
+	if !validID.MatchString(id) || !s.exists(id) {
+		return "", fmt.Errorf("%s: %s", ref, ErrNotFound)
+	}
+
+	return id, nil
+}
+
+// List returns all stored snapshots, the oldest first
+func (s *Store) List() ([]Entry, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	baseline, err := s.Baseline()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Entry{}
+	for _, id := range ids {
+		rep, err := s.Load(id)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, Entry{
+			ID:              id,
+			Time:            rep.ScanStart,
+			Server:          rep.Server.Host,
+			ResourceObjects: len(rep.ResourceObjects),
+			Baseline:        id == baseline,
+		})
+	}
+
+	return ret, nil
+}
+
+// Baseline returns the ID of the baseline or an empty string if none is set
+func (s *Store) Baseline() (string, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(s.dir, "baseline"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(raw)), nil
+}
+
+// SetBaseline marks the snapshot referenced by ref as baseline
+func (s *Store) SetBaseline(ref string) error {
+	id, err := s.Resolve(ref)
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(filepath.Join(s.dir, "baseline"), []byte(id+"\n"), 0600)
+}
+
+// Prune removes the snapshots which are neither one of the keep newest nor
+// taken within olderThan before now. A value of 0 disables the respective
+// condition. The baseline is never removed. The IDs of the removed snapshots
+// are returned.
+func (s *Store) Prune(keep int, olderThan time.Duration, now time.Time) ([]string, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	baseline, err := s.Baseline()
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for i, id := range ids {
+		if id == baseline {
+			continue
+		}
+
+		if keep > 0 && i >= len(ids)-keep {
+			continue
+		}
+
+		if olderThan > 0 && !idTime(id).Before(now.Add(-olderThan)) {
+			continue
+		}
+
+		err := os.Remove(s.snapshotFile(id))
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+
+	return removed, nil
+}
+
+// ids returns the IDs of all snapshots, the oldest first
+func (s *Store) ids() ([]string, error) {
+	files, err := ioutil.ReadDir(s.snapshotDir())
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, f := range files {
+		id := strings.TrimSuffix(f.Name(), ".yaml")
+		if f.IsDir() || !validID.MatchString(id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return idLess(ids[i], ids[j])
+	})
+
+	return ids, nil
+}
+
+func (s *Store) exists(id string) bool {
+	_, err := os.Stat(s.snapshotFile(id))
+	return err == nil
+}
+
+func (s *Store) snapshotDir() string {
+	return filepath.Join(s.dir, "snapshots")
+}
+
+func (s *Store) snapshotFile(id string) string {
+	return filepath.Join(s.snapshotDir(), id+".yaml")
+}
+
+// idTime returns the time encoded in the ID
+func idTime(id string) time.Time {
+	t, _ := time.Parse(idFormat, id[:len(idFormat)])
+	return t
+}
+
+// idLess orders IDs by time and suffix
+func idLess(a, b string) bool {
+	if a[:len(idFormat)] != b[:len(idFormat)] {
+		return a < b
+	}
+
+	return idSuffix(a) < idSuffix(b)
+}
+
+func idSuffix(id string) int {
+	n := 1
+	fmt.Sscanf(id[len(idFormat):], "-%d", &n)
+	return n
+}
+
+// WriteFile writes the file with the permissions perm atomically, so that
+// readers never see a partial file
+func WriteFile(file string, raw []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(raw)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+)
+
+func newStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "kubewire-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func save(t *testing.T, s *Store, start time.Time) string {
+	id, err := s.Save(report.Report{
+		ScanStart:       start,
+		Server:          report.Server{Host: "https://cluster"},
+		ResourceObjects: []report.ResourceObject{{GroupVersion: "v1", Resource: "namespaces", Name: "default"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func TestStore(t *testing.T) {
+	s, cleanup := newStore(t)
+	defer cleanup()
+
+	if _, err := s.Load(RefLatest); err == nil {
+		t.Error("Expected an error for @latest of an empty store")
+	}
+
+	start := time.Date(2018, 6, 12, 14, 19, 14, 0, time.UTC)
+	ids := []string{save(t, s, start), save(t, s, start), save(t, s, start.Add(time.Hour))}
+
+	exp := []string{"20180612-141914", "20180612-141914-2", "20180612-151914"}
+	if !reflect.DeepEqual(ids, exp) {
+		t.Fatalf("Got IDs %v, expected %v", ids, exp)
+	}
+
+	if _, err := s.Load(RefBaseline); err == nil {
+		t.Error("Expected an error for @baseline without baseline")
+	}
+
+	if err := s.SetBaseline("@" + ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, id := range map[string]string{RefLatest: ids[2], RefBaseline: ids[1], ids[0]: ids[0], "@" + ids[0]: ids[0]} {
+		got, err := s.Resolve(ref)
+		if err != nil || got != id {
+			t.Errorf("Got %s (%v) for %s, expected %s", got, err, ref, id)
+		}
+	}
+
+	for _, ref := range []string{"@20180101-000000", "@../baseline", "@"} {
+		if _, err := s.Resolve(ref); err == nil {
+			t.Errorf("Expected an error for %s", ref)
+		}
+	}
+
+	rep, err := s.Load(RefLatest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.ScanStart.Equal(start.Add(time.Hour)) || len(rep.ResourceObjects) != 1 {
+		t.Errorf("Got unexpected snapshot %+v", rep)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || !entries[1].Baseline || entries[0].Baseline || entries[2].Server != "https://cluster" || entries[2].ResourceObjects != 1 {
+		t.Errorf("Got unexpected entries %+v", entries)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	s, cleanup := newStore(t)
+	defer cleanup()
+
+	now := time.Date(2018, 6, 12, 0, 0, 0, 0, time.UTC)
+	ids := []string{}
+	for d := 5; d > 0; d-- {
+		ids = append(ids, save(t, s, now.Add(-time.Duration(d)*24*time.Hour)))
+	}
+
+	if err := s.SetBaseline(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keeps the baseline, the newest two and the ones of the last 3.5 days
+	removed, err := s.Prune(2, 84*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{ids[1]}; !reflect.DeepEqual(removed, exp) {
+		t.Errorf("Got removed %v, expected %v", removed, exp)
+	}
+
+	removed, err = s.Prune(1, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{ids[2], ids[3]}; !reflect.DeepEqual(removed, exp) {
+		t.Errorf("Got removed %v, expected %v", removed, exp)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != ids[0] || entries[1].ID != ids[4] {
+		t.Errorf("Got unexpected entries %+v", entries)
+	}
+}
+
+func TestStoreSaveConcurrently(t *testing.T) {
+	s, cleanup := newStore(t)
+	defer cleanup()
+
+	start := time.Date(2018, 6, 12, 14, 19, 14, 0, time.UTC)
+	ids := make([]string, 10)
+	wg := sync.WaitGroup{}
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if ids[i], err = s.Save(report.Report{ScanStart: start}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			t.Errorf("Got the ID %s twice in %v", id, ids)
+		}
+		seen[id] = true
+	}
+
+	for _, id := range ids {
+		if _, err := s.Load(id); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubewire-write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "baseline.yaml")
+	for _, content := range []string{"a: 1\n", "b: 2\n"} {
+		if err := WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "b: 2\n" {
+		t.Errorf("Got %q, expected the content of the last write", raw)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Got the mode %s, expected 0644", info.Mode())
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Got %d files, expected no temporary files", len(files))
+	}
+}
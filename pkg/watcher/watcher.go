@@ -0,0 +1,291 @@
+package watcher
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"github.com/postfinance/kubewire/pkg/retrieval"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Event holds the differences of a single resource object to the baseline
+type Event struct {
+	Time        time.Time
+	Differences []report.DiffReport
+}
+
+// Watcher watches all listable resource objects which are global or in the
+// namespaces of the baseline and reports their differences to the baseline
+// as soon as they happen
+type Watcher struct {
+	// Events receives an Event whenever the differences of an object to the
+	// baseline change
+	Events chan Event
+
+	baseline   map[string]report.ResourceObject // by Key()
+	namespaces []string
+	opts       retrieval.Options
+	ignore     *report.Ignore
+
+	mu    sync.Mutex
+	state map[string]string // last reported differences by Key()
+
+	informers map[string]informer // by informerKey()
+}
+
+// informer defines a running informer
+type informer struct {
+	groupVersion string
+	stop         chan struct{}
+}
+
+// New creates a Watcher for the baseline. The objects are retrieved the same way
+// as the baseline was created. ignore may be nil and must be compiled otherwise
+func New(baseline report.Report, ignore *report.Ignore) *Watcher {
+	w := &Watcher{
+		Events:     make(chan Event, 100),
+		baseline:   map[string]report.ResourceObject{},
+		namespaces: baseline.Configuration.Namespaces,
+		opts: retrieval.Options{
+			PreferredVersions: baseline.Configuration.PreferredVersions,
+			ContentHash:       baseline.Configuration.ContentHash,
+			Content:           baseline.Configuration.Content,
+			Metadata:          baseline.Configuration.Metadata,
+			Labels:            baseline.Configuration.Labels,
+			Annotations:       baseline.Configuration.Annotations,
+		},
+		ignore:    ignore,
+		state:     map[string]string{},
+		informers: map[string]informer{},
+	}
+
+	for _, obj := range baseline.ResourceObjects {
+		w.baseline[obj.Key()] = obj
+	}
+
+	return w
+}
+
+// Run watches the cluster until stop is closed. The API resources are
+// discovered every interval, so that informers for new resources e.g. of
+// CustomResourceDefinitions are started and the ones of removed resources are
+// stopped. The informers relist the objects whenever their watch expires.
+func (w *Watcher) Run(config *rest.Config, interval time.Duration, stop <-chan struct{}) error {
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		resources, err := retrieval.Resources(config, w.opts)
+		if perr, ok := err.(*retrieval.PartialError); ok {
+			// Keep the informers of the failed API groups
+			log.Println(err)
+			w.sync(dyn, resources, perr.Errors)
+		} else if err != nil {
+			// Keep the running informers until the next discovery
+			log.Println("discovery failed:", err)
+		} else {
+			w.sync(dyn, resources, nil)
+		}
+
+		select {
+		case <-stop:
+			w.sync(dyn, nil, nil)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync starts the informers for new resources and stops the ones for
+// resources which are not served anymore. The informers of API groups which
+// failed to be discovered are kept
+func (w *Watcher) sync(dyn dynamic.Interface, resources []report.Resource, failed []report.RetrievalError) {
+	wanted := map[string]bool{}
+	keep := map[string]bool{}
+	for _, e := range failed {
+		keep[e.GroupVersion] = true
+	}
+
+	for _, resource := range resources {
+		if !resource.Listable || !resource.HasVerb("watch") {
+			continue
+		}
+
+		namespaces := []string{""}
+		if resource.Namespaced {
+			namespaces = w.namespaces
+		}
+
+		for _, ns := range namespaces {
+			key := informerKey(resource, ns)
+			wanted[key] = true
+
+			if _, ok := w.informers[key]; ok {
+				continue
+			}
+
+			stop := make(chan struct{})
+			w.informers[key] = informer{groupVersion: resource.GroupVersion, stop: stop}
+
+			err := w.start(dyn, resource, ns, stop)
+			if err != nil {
+				log.Println("watching", key, "failed:", err)
+				delete(w.informers, key)
+			}
+		}
+	}
+
+	for key, i := range w.informers {
+		if !wanted[key] && !keep[i.groupVersion] {
+			close(i.stop)
+			delete(w.informers, key)
+		}
+	}
+}
+
+// start runs an informer for the resource in the namespace ns
+func (w *Watcher) start(dyn dynamic.Interface, resource report.Resource, ns string, stop chan struct{}) error {
+	gv, err := schema.ParseGroupVersion(resource.GroupVersion)
+	if err != nil {
+		return err
+	}
+
+	inf := dynamicinformer.NewFilteredDynamicInformer(dyn, gv.WithResource(resource.Name), ns, 0, cache.Indexers{}, nil).Informer()
+	inf.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			w.update(obj, resource)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			w.update(obj, resource)
+		},
+		DeleteFunc: func(obj interface{}) {
+			w.delete(obj, resource)
+		},
+	})
+
+	go inf.Run(stop)
+
+	go func() {
+		if cache.WaitForCacheSync(stop, inf.HasSynced) {
+			w.checkRemoved(resource, ns, inf.GetStore())
+		}
+	}()
+
+	return nil
+}
+
+// update handles a new or modified object
+func (w *Watcher) update(item interface{}, resource report.Resource) {
+	raw, ok := item.(runtime.Object)
+	if !ok {
+		return
+	}
+
+	obj, err := retrieval.ExtractResourceObject(raw, resource, w.opts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	a := []report.ResourceObject{}
+	if base, ok := w.baseline[obj.Key()]; ok {
+		a = append(a, base)
+	}
+
+	w.report(obj.Key(), report.DiffResourceObjects(a, []report.ResourceObject{obj}, w.ignore))
+}
+
+// delete handles a deleted object
+func (w *Watcher) delete(item interface{}, resource report.Resource) {
+	if tombstone, ok := item.(cache.DeletedFinalStateUnknown); ok {
+		item = tombstone.Obj
+	}
+
+	raw, ok := item.(runtime.Object)
+	if !ok {
+		return
+	}
+
+	obj, err := retrieval.ExtractResourceObject(raw, resource, retrieval.Options{})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	w.removed(obj.Key())
+}
+
+// removed reports the removal of the object with key, if it is part of the
+// baseline
+func (w *Watcher) removed(key string) {
+	a := []report.ResourceObject{}
+	if base, ok := w.baseline[key]; ok {
+		a = append(a, base)
+	}
+
+	w.report(key, report.DiffResourceObjects(a, []report.ResourceObject{}, w.ignore))
+}
+
+// checkRemoved reports the objects of the baseline for the resource in the
+// namespace ns, which are missing in the synced store
+func (w *Watcher) checkRemoved(resource report.Resource, ns string, store cache.Store) {
+	keys := []string{}
+	for key, obj := range w.baseline {
+		if obj.GroupVersion != resource.GroupVersion || obj.Resource != resource.Name || obj.Namespace != ns {
+			continue
+		}
+
+		storeKey := obj.Name
+		if ns != "" {
+			storeKey = ns + "/" + obj.Name
+		}
+
+		if _, exists, _ := store.GetByKey(storeKey); !exists {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.removed(key)
+	}
+}
+
+// report sends an Event if the differences of the object with key have
+// changed since the last report. Objects returning to the state of the baseline
+// are not reported
+func (w *Watcher) report(key string, diffs []report.DiffReport) {
+	state := []string{}
+	for _, d := range diffs {
+		state = append(state, d.String())
+	}
+
+	s := strings.Join(state, "\n")
+
+	w.mu.Lock()
+	changed := w.state[key] != s
+	w.state[key] = s
+	w.mu.Unlock()
+
+	if changed && len(diffs) != 0 {
+		w.Events <- Event{Time: time.Now(), Differences: diffs}
+	}
+}
+
+func informerKey(resource report.Resource, ns string) string {
+	return resource.GroupVersion + " " + resource.Name + " " + ns
+}
@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/postfinance/kubewire/pkg/report"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+var serviceaccounts = report.Resource{GroupVersion: "v1", Name: "serviceaccounts", Namespaced: true}
+
+func newServiceAccount(name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ServiceAccount")
+	obj.SetNamespace("kube-system")
+	obj.SetName(name)
+
+	return obj
+}
+
+func newWatcher() *Watcher {
+	return New(report.Report{
+		Configuration: report.Configuration{Namespaces: []string{"kube-system"}},
+		ResourceObjects: []report.ResourceObject{
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "kube-system", Name: "default"},
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "kube-system", Name: "kube-proxy"},
+		},
+	}, nil)
+}
+
+// events returns the differences of all pending events
+func events(w *Watcher) []report.DiffReport {
+	ret := []report.DiffReport{}
+	for {
+		select {
+		case e := <-w.Events:
+			ret = append(ret, e.Differences...)
+		default:
+			return ret
+		}
+	}
+}
+
+func TestWatcherAdded(t *testing.T) {
+	w := newWatcher()
+	w.update(newServiceAccount("default"), serviceaccounts)
+	w.update(newServiceAccount("shouldnotbehere"), serviceaccounts)
+	// Updates without changes of the differences are not reported again
+	w.update(newServiceAccount("shouldnotbehere"), serviceaccounts)
+
+	diffs := events(w)
+	if len(diffs) != 1 || diffs[0].Kind != report.ChangeAdded || diffs[0].ResourceObject.Name != "shouldnotbehere" {
+		t.Errorf("Got %v, expected shouldnotbehere to be added", diffs)
+	}
+}
+
+func TestWatcherRemoved(t *testing.T) {
+	w := newWatcher()
+	w.delete(cache.DeletedFinalStateUnknown{Key: "kube-system/default", Obj: newServiceAccount("default")}, serviceaccounts)
+	w.delete(newServiceAccount("shouldnotbehere"), serviceaccounts)
+
+	diffs := events(w)
+	if len(diffs) != 1 || diffs[0].Kind != report.ChangeRemoved || diffs[0].ResourceObject.Name != "default" {
+		t.Errorf("Got %v, expected default to be removed", diffs)
+	}
+}
+
+func TestWatcherCheckRemoved(t *testing.T) {
+	w := newWatcher()
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(newServiceAccount("default"))
+
+	w.checkRemoved(serviceaccounts, "kube-system", store)
+
+	diffs := events(w)
+	if len(diffs) != 1 || diffs[0].Kind != report.ChangeRemoved || diffs[0].ResourceObject.Name != "kube-proxy" {
+		t.Errorf("Got %v, expected kube-proxy to be removed", diffs)
+	}
+}
+
+func TestWatcherModified(t *testing.T) {
+	w := New(report.Report{
+		Configuration: report.Configuration{Namespaces: []string{"kube-system"}, ContentHash: true},
+		ResourceObjects: []report.ResourceObject{
+			{GroupVersion: "v1", Resource: "serviceaccounts", Namespace: "kube-system", Name: "default", Hash: "sha256:0"},
+		},
+	}, nil)
+	w.update(newServiceAccount("default"), serviceaccounts)
+
+	diffs := events(w)
+	if len(diffs) != 1 || diffs[0].Kind != report.ChangeModified {
+		t.Errorf("Got %v, expected default to be modified", diffs)
+	}
+}